@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/linkerd/namerctl/namer"
+	"github.com/spf13/cobra"
+)
+
+var (
+	addrWatch = false
+
+	addrCmd = &cobra.Command{
+		Use:   "addr [namespace] [id]",
+		Short: "Show the addresses of a bound name",
+		Long: `Show the addresses of a bound name.
+
+The id is a bound name as shown by 'namerctl bind', such as
+/#/io.l5d.fs/users. Its addresses are printed as a table with the
+metadata the namer attached to each of them.
+
+With --watch, the addresses are printed once, and then each address
+added or removed afterwards is printed as ADDED or REMOVED, until
+namerctl is interrupted. With --json, each set of addresses is printed
+in full as a JSON object on its own line.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			args = withDefaultNamespace(args, 2)
+			switch len(args) {
+			case 2:
+				ctl, err := getController()
+				if err != nil {
+					return err
+				}
+				addresser, ok := ctl.(namer.Addresser)
+				if !ok {
+					return &namer.ErrUnsupported{Operation: "looking up addresses"}
+				}
+				ns := args[0]
+				id, err := namer.ParsePath(args[1])
+				if err != nil {
+					return fmt.Errorf("invalid id '%s': %s", args[1], err)
+				}
+
+				if !addrWatch {
+					addr, err := addresser.Addr(cmdContext, ns, id)
+					if err != nil {
+						return err
+					}
+					return printAddr(os.Stdout, addr, false)
+				}
+
+				addrs, err := addresser.WatchAddr(cmdContext, ns, id)
+				if err != nil {
+					return err
+				}
+				if err := printAddrUpdates(addrs, false, "addresses of %s in %s", id, ns); err != nil {
+					return err
+				}
+				if cmdContext.Err() != nil {
+					return nil
+				}
+
+				// The watch ended on its own; find out why.
+				if _, err := addresser.Addr(cmdContext, ns, id); err != nil {
+					return err
+				}
+				return fmt.Errorf("watch of %s in %s ended", id, ns)
+
+			default:
+				return errors.New("addr requires a namespace and a bound id")
+			}
+		},
+	}
+)
+
+func init() {
+	addrCmd.PersistentFlags().BoolVar(&addrWatch, "watch", false,
+		"print addresses as they are added and removed")
+	addrCmd.PersistentFlags().BoolVar(&jsonOutput, "json", false, "output in json instead of text")
+	RootCmd.AddCommand(addrCmd)
+}
+
+// printAddr prints the addresses of addr as a table, or addr as JSON with
+// --json. If weighted is set, the table shows the weight of each address
+// and the share of requests it receives.
+func printAddr(w io.Writer, addr *namer.Addr, weighted bool) error {
+	if jsonOutput {
+		bytes, err := json.Marshal(addr)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(bytes))
+		return nil
+	}
+
+	if addr.Type != namer.AddrTypeBound {
+		fmt.Fprintln(w, addrState(addr))
+		return nil
+	}
+	if len(addr.Addrs) == 0 {
+		fmt.Fprintln(w, "no addresses")
+		return nil
+	}
+	addresses := append([]*namer.Address{}, addr.Addrs...)
+	namer.SortAddresses(addresses)
+	table := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	if !weighted {
+		fmt.Fprintln(table, "ADDRESS\tMETA")
+		for _, address := range addresses {
+			fmt.Fprintf(table, "%s\t%s\n", address, namer.MetaString(address.Meta))
+		}
+		return table.Flush()
+	}
+
+	total := 0.0
+	for _, address := range addresses {
+		total += address.Weight()
+	}
+	fmt.Fprintln(table, "ADDRESS\tWEIGHT\tSHARE\tMETA")
+	for _, address := range addresses {
+		share := 0.0
+		if total > 0 {
+			share = 100 * address.Weight() / total
+		}
+		meta := map[string]interface{}{}
+		for key, value := range address.Meta {
+			if key != namer.AddressWeightKey {
+				meta[key] = value
+			}
+		}
+		fmt.Fprintf(table, "%s\t%g\t%.1f%%\t%s\n", address, address.Weight(), share, namer.MetaString(meta))
+	}
+	return table.Flush()
+}
+
+// printAddrUpdates prints the first Addr received from addrs in full, as
+// printAddr does, introduced by a header described by format and args,
+// and then only the addresses added and removed, until addrs is closed.
+func printAddrUpdates(addrs <-chan *namer.Addr, weighted bool, format string, args ...interface{}) error {
+	var last *namer.Addr
+	for addr := range addrs {
+		switch {
+		case jsonOutput || last == nil:
+			if !jsonOutput {
+				printWatchHeader(true, format, args...)
+			}
+			if err := printAddr(os.Stdout, addr, weighted); err != nil {
+				return err
+			}
+		default:
+			printAddrChanges(os.Stdout, last, addr)
+		}
+		last = addr
+	}
+	return nil
+}
+
+// printAddrChanges prints how addr differs from last, one line per
+// address added or removed.
+func printAddrChanges(w io.Writer, last, addr *namer.Addr) {
+	if addr.Type != last.Type || addr.Cause != last.Cause {
+		fmt.Fprintf(w, "%-7s %s\n", "STATE", addrState(addr))
+	}
+	added, removed := namer.DiffAddrs(last, addr)
+	for _, address := range removed {
+		fmt.Fprintf(w, "%-7s %s\n", "REMOVED", address)
+	}
+	for _, address := range added {
+		if meta := namer.MetaString(address.Meta); meta != "" {
+			fmt.Fprintf(w, "%-7s %s %s\n", "ADDED", address, meta)
+		} else {
+			fmt.Fprintf(w, "%-7s %s\n", "ADDED", address)
+		}
+	}
+}
+
+// addrState describes the type of addr in words.
+func addrState(addr *namer.Addr) string {
+	switch addr.Type {
+	case namer.AddrTypeBound:
+		return "bound"
+	case namer.AddrTypeNeg:
+		return "~ negative: the name has no addresses"
+	case namer.AddrTypePending:
+		return "pending: the namer has not resolved the name yet"
+	case namer.AddrTypeFailed:
+		return "! failed: " + addr.Cause
+	default:
+		return addr.Type
+	}
+}
+
+// addrSummary describes addr in a few words, such as "3 addresses".
+func addrSummary(addr *namer.Addr) string {
+	if addr.Type != namer.AddrTypeBound {
+		return addrState(addr)
+	}
+	if len(addr.Addrs) == 1 {
+		return "1 address"
+	}
+	return fmt.Sprintf("%d addresses", len(addr.Addrs))
+}
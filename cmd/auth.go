@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/linkerd/namerctl/namer"
+	"github.com/spf13/viper"
+)
+
+// headerFlags holds the values of --header, which may be repeated.
+var headerFlags []string
+
+// getAuthOptions returns the controller options for the token,
+// token-file, token-command, username, password and header settings.
+func getAuthOptions(settings *viper.Viper) ([]namer.Option, error) {
+	opts := []namer.Option{}
+
+	token := settings.GetString("token")
+	tokenFile := settings.GetString("token-file")
+	tokenCommand := settings.GetString("token-command")
+	sources := 0
+	for _, setting := range []string{token, tokenFile, tokenCommand} {
+		if setting != "" {
+			sources++
+		}
+	}
+	switch {
+	case sources > 1:
+		return nil, errors.New("only one of --token, --token-file and --token-command may be set")
+	case token != "":
+		opts = append(opts, namer.WithBearerToken(namer.StaticToken(token)))
+	case tokenFile != "":
+		opts = append(opts, namer.WithBearerToken(namer.FileToken(tokenFile)))
+	case tokenCommand != "":
+		opts = append(opts, namer.WithBearerToken(namer.CommandToken(tokenCommand)))
+	}
+
+	username := settings.GetString("username")
+	password := settings.GetString("password")
+	if username != "" || password != "" {
+		if sources > 0 {
+			return nil, errors.New("a bearer token and basic auth cannot both be used")
+		}
+		opts = append(opts, namer.WithBasicAuth(username, password))
+	}
+
+	header := http.Header{}
+	for _, line := range getHeaderSettings(settings) {
+		colon := strings.Index(line, ":")
+		if colon <= 0 {
+			return nil, fmt.Errorf("invalid header '%s': expected 'Name: value'", line)
+		}
+		header.Add(strings.TrimSpace(line[:colon]), strings.TrimSpace(line[colon+1:]))
+	}
+	if len(header) > 0 {
+		opts = append(opts, namer.WithHeader(header))
+	}
+
+	return opts, nil
+}
+
+// getHeaderSettings returns the headers given with --header or, if there
+// are none, in the configuration file or NAMERCTL_HEADER, where several
+// headers are separated by newlines.
+func getHeaderSettings(settings *viper.Viper) []string {
+	if len(headerFlags) > 0 {
+		return headerFlags
+	}
+	switch headers := settings.Get("header").(type) {
+	case string:
+		lines := []string{}
+		for _, line := range strings.Split(headers, "\n") {
+			if strings.TrimSpace(line) != "" {
+				lines = append(lines, line)
+			}
+		}
+		return lines
+	case []interface{}:
+		lines := make([]string, len(headers))
+		for i, header := range headers {
+			lines[i] = fmt.Sprint(header)
+		}
+		return lines
+	case []string:
+		return headers
+	}
+	return nil
+}
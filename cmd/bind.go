@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/linkerd/namerctl/namer"
+	"github.com/spf13/cobra"
+)
+
+var (
+	bindOverlay = ""
+	bindWatch   = false
+	jsonOutput  = false
+
+	bindCmd = &cobra.Command{
+		Use:   "bind [namespace] [path]",
+		Short: "Show the names a path is bound to by namerd",
+		Long: `Show the names a path is bound to by namerd.
+
+namerd delegates the path through the namespace's delegation table and
+binds it with its namers. The result is a tree of bound names: each leaf
+shows the id of a bound name, and its residual path if it has one.
+
+With --dtab, the given dentries are added to the namespace's delegation
+table for this request only, as a request's l5d-dtab header would be.
+
+With --watch, the tree is printed again each time it changes, until
+namerctl is interrupted. With --json, each tree is printed as a JSON
+object on its own line.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			args = withDefaultNamespace(args, 2)
+			switch len(args) {
+			case 2:
+				ctl, err := getController()
+				if err != nil {
+					return err
+				}
+				binder, ok := ctl.(namer.Binder)
+				if !ok {
+					return &namer.ErrUnsupported{Operation: "binding names"}
+				}
+				ns := args[0]
+				path, err := namer.ParsePath(args[1])
+				if err != nil {
+					return fmt.Errorf("invalid path '%s': %s", args[1], err)
+				}
+				overlay, err := parseOverlay(bindOverlay)
+				if err != nil {
+					return err
+				}
+
+				if !bindWatch {
+					tree, err := binder.Bind(cmdContext, ns, path, overlay)
+					if err != nil {
+						return err
+					}
+					return printBoundTree(os.Stdout, tree)
+				}
+
+				trees, err := binder.WatchBind(cmdContext, ns, path, overlay)
+				if err != nil {
+					return err
+				}
+				first := true
+				for tree := range trees {
+					if !jsonOutput {
+						printWatchHeader(first, "bind of %s in %s", path, ns)
+					}
+					if err := printBoundTree(os.Stdout, tree); err != nil {
+						return err
+					}
+					first = false
+				}
+				if cmdContext.Err() != nil {
+					return nil
+				}
+
+				// The watch ended on its own; find out why.
+				if _, err := binder.Bind(cmdContext, ns, path, overlay); err != nil {
+					return err
+				}
+				return fmt.Errorf("watch of %s in %s ended", path, ns)
+
+			default:
+				return errors.New("bind requires a namespace and a path")
+			}
+		},
+	}
+)
+
+func init() {
+	bindCmd.PersistentFlags().StringVar(&bindOverlay, "dtab", "",
+		"dentries to add to the namespace's dtab for this request")
+	bindCmd.PersistentFlags().BoolVar(&bindWatch, "watch", false,
+		"print the tree again each time it changes")
+	bindCmd.PersistentFlags().BoolVar(&jsonOutput, "json", false, "output in json instead of text")
+	RootCmd.AddCommand(bindCmd)
+}
+
+// parseOverlay parses the value of a --dtab flag.
+func parseOverlay(dtabstr string) (namer.Dtab, error) {
+	if dtabstr == "" {
+		return nil, nil
+	}
+	return validateDtab("--dtab", dtabstr)
+}
+
+// printWatchHeader introduces each value printed by a --watch command,
+// separating it from the previous one.
+func printWatchHeader(first bool, format string, args ...interface{}) {
+	if !first {
+		fmt.Println()
+	}
+	fmt.Printf("# %s at %s\n", fmt.Sprintf(format, args...), time.Now().Format(time.RFC3339))
+}
+
+// printBoundTree draws tree with one node per line, or prints it as JSON
+// with --json.
+func printBoundTree(w io.Writer, tree *namer.BoundTree) error {
+	if jsonOutput {
+		bytes, err := json.Marshal(tree)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(bytes))
+		return nil
+	}
+	fmt.Fprintln(w, boundNodeLabel(tree))
+	printBoundChildren(w, tree, "")
+	return nil
+}
+
+func printBoundChildren(w io.Writer, tree *namer.BoundTree, indent string) {
+	children := []*namer.BoundTree{}
+	weights := []string{}
+	switch tree.Type {
+	case namer.DelegateTypeAlt:
+		for _, child := range tree.Alt {
+			children = append(children, child)
+			weights = append(weights, "")
+		}
+	case namer.DelegateTypeUnion:
+		for _, w := range tree.Union {
+			children = append(children, w.Tree)
+			weights = append(weights, fmt.Sprintf("%g * ", w.Weight))
+		}
+	}
+
+	for i, child := range children {
+		branch, next := "|-- ", "|   "
+		if i == len(children)-1 {
+			branch, next = "`-- ", "    "
+		}
+		fmt.Fprintf(w, "%s%s%s%s\n", indent, branch, weights[i], boundNodeLabel(child))
+		printBoundChildren(w, child, indent+next)
+	}
+}
+
+func boundNodeLabel(tree *namer.BoundTree) string {
+	switch tree.Type {
+	case namer.DelegateTypeLeaf:
+		if tree.Bound == nil {
+			return "? unbound leaf"
+		}
+		label := tree.Bound.ID.String()
+		if len(tree.Bound.Path) > 0 {
+			label += fmt.Sprintf(" (residual %s)", tree.Bound.Path)
+		}
+		return label
+	case namer.DelegateTypeAlt:
+		return "| alternates"
+	case namer.DelegateTypeUnion:
+		return "& union"
+	case namer.DelegateTypeNeg:
+		return "~ negative"
+	case namer.DelegateTypeFail:
+		return "! fail"
+	case namer.DelegateTypeEmpty:
+		return "$ empty"
+	default:
+		return tree.Type
+	}
+}
@@ -0,0 +1,421 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// contextSettings are the settings a context may hold. Each is also a
+// global flag, except for namespace.
+var contextSettings = []string{
+	"base-url", "timeout", "retries",
+	"ca-file", "cert-file", "key-file", "server-name", "insecure-skip-verify",
+	"token", "token-file", "token-command", "username", "password", "header",
+	"namespace",
+}
+
+// defaultConfigFile is created by set-context when no configuration file
+// was found.
+const defaultConfigFile = ".namerctl.yaml"
+
+var (
+	contextName  string
+	contextErr   error
+	setNamespace string
+
+	configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "Manage the contexts in namerctl's configuration file",
+		Long: `Manage the contexts in namerctl's configuration file.
+
+A context names a namerd cluster and the settings to reach it: its base
+URL, TLS and authentication settings, timeout and default namespace.
+Contexts are kept under "contexts" in the configuration file, and the
+one named by "current-context" is used unless --context or
+NAMERCTL_CONTEXT selects another. Flags and environment variables
+override the settings of the context.
+
+Commands that take a namespace first, such as 'namerctl bind' and
+'namerctl dtab get', use the context's namespace when it is omitted.
+
+The dtab get, create, update, delete and apply commands can run against
+several contexts at once with --contexts a,b,c or --all-contexts. They
+print the result for each context; with --atomic, the changes made are
+rolled back if any context fails.
+
+Only YAML and JSON configuration files can be edited by these commands.`,
+	}
+
+	configGetContextsCmd = &cobra.Command{
+		Use:   "get-contexts",
+		Short: "List the contexts in the configuration file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return errors.New("get-contexts does not take arguments")
+			}
+			_, config, err := readConfigFile()
+			if err != nil {
+				return err
+			}
+			contexts, err := configContexts(config)
+			if err != nil {
+				return err
+			}
+			names := make([]string, 0, len(contexts))
+			for name := range contexts {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			current := selectedContext()
+			table := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(table, "CURRENT\tNAME\tBASE-URL\tNAMESPACE")
+			for _, name := range names {
+				marker := ""
+				if name == current {
+					marker = "*"
+				}
+				settings := contexts[name]
+				fmt.Fprintf(table, "%s\t%s\t%v\t%v\n", marker, name,
+					orEmpty(settings["base-url"]), orEmpty(settings["namespace"]))
+			}
+			return table.Flush()
+		},
+	}
+
+	configCurrentContextCmd = &cobra.Command{
+		Use:   "current-context",
+		Short: "Print the name of the context in use",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return errors.New("current-context does not take arguments")
+			}
+			current := selectedContext()
+			if current == "" {
+				return errors.New("no context is in use")
+			}
+			fmt.Println(current)
+			return nil
+		},
+	}
+
+	configUseContextCmd = &cobra.Command{
+		Use:   "use-context [name]",
+		Short: "Make a context the current context",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("use-context requires a context name")
+			}
+			path, config, err := readConfigFile()
+			if err != nil {
+				return err
+			}
+			contexts, err := configContexts(config)
+			if err != nil {
+				return err
+			}
+			if _, ok := contexts[args[0]]; !ok {
+				return fmt.Errorf("no context named %s in %s", args[0], path)
+			}
+			config["current-context"] = args[0]
+			if err := writeConfigFile(path, config); err != nil {
+				return err
+			}
+			fmt.Printf("Switched to context %s\n", args[0])
+			return nil
+		},
+	}
+
+	configSetContextCmd = &cobra.Command{
+		Use:   "set-context [name]",
+		Short: "Create a context or change its settings",
+		Long: `Create a context or change its settings.
+
+The settings of the context are taken from the global flags given with
+this command, such as --base-url, --ca-file or --token-file, and from
+--namespace. Settings that are not given are left unchanged. For example:
+
+  namerctl config set-context prod-eu --base-url https://namerd.eu:4180 \
+      --ca-file /etc/namerd/ca.pem --namespace default`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("set-context requires a context name")
+			}
+			name := args[0]
+			path, config, err := readConfigFile()
+			if err != nil {
+				return err
+			}
+			contexts, err := configContexts(config)
+			if err != nil {
+				return err
+			}
+
+			settings, ok := contexts[name]
+			if !ok {
+				settings = map[string]interface{}{}
+			}
+			changed := 0
+			for _, key := range contextSettings {
+				value, ok := changedSetting(cmd, key)
+				if ok {
+					settings[key] = value
+					changed++
+				}
+			}
+			if changed == 0 && ok {
+				return errors.New("no settings given; see 'namerctl config set-context --help'")
+			}
+
+			contexts[name] = settings
+			config["contexts"] = contexts
+			if err := writeConfigFile(path, config); err != nil {
+				return err
+			}
+			if ok {
+				fmt.Printf("Updated context %s in %s\n", name, path)
+			} else {
+				fmt.Printf("Created context %s in %s\n", name, path)
+			}
+			return nil
+		},
+	}
+)
+
+func init() {
+	RootCmd.PersistentFlags().StringVar(&contextName, "context", "",
+		"the configuration context to use")
+	viper.BindPFlag("context", RootCmd.PersistentFlags().Lookup("context"))
+
+	configCmd.AddCommand(configGetContextsCmd)
+	configCmd.AddCommand(configCurrentContextCmd)
+	configCmd.AddCommand(configUseContextCmd)
+	configSetContextCmd.Flags().StringVar(&setNamespace, "namespace", "",
+		"default namespace of the context")
+	configCmd.AddCommand(configSetContextCmd)
+	RootCmd.AddCommand(configCmd)
+}
+
+// selectedContext returns the name of the context in use, if any.
+func selectedContext() string {
+	if name := viper.GetString("context"); name != "" {
+		return name
+	}
+	return viper.GetString("current-context")
+}
+
+// loadSettings returns the settings of the named context, or only those
+// given outside of contexts if name is empty. Flags and environment
+// variables that are set take precedence over the context's settings.
+func loadSettings(name string) (*viper.Viper, error) {
+	loaded := viper.New()
+	for _, key := range contextSettings {
+		loaded.Set(key, viper.Get(key))
+	}
+	if name == "" {
+		return loaded, nil
+	}
+
+	path, config, err := readConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	contexts, err := configContexts(config)
+	if err != nil {
+		return nil, err
+	}
+	values, ok := contexts[name]
+	if !ok {
+		if viper.ConfigFileUsed() == "" {
+			return nil, fmt.Errorf("no context named %s: no configuration file was found", name)
+		}
+		return nil, fmt.Errorf("no context named %s in %s", name, path)
+	}
+
+	for key, value := range values {
+		if !isContextSetting(key) {
+			return nil, fmt.Errorf("context %s: unknown setting '%s'", name, key)
+		}
+		if flag := RootCmd.PersistentFlags().Lookup(key); flag != nil && flag.Changed {
+			continue
+		}
+		if _, ok := os.LookupEnv(envName(key)); ok {
+			continue
+		}
+		loaded.Set(key, value)
+	}
+	return loaded, nil
+}
+
+func isContextSetting(key string) bool {
+	for _, setting := range contextSettings {
+		if key == setting {
+			return true
+		}
+	}
+	return false
+}
+
+// envName is the environment variable that holds setting key.
+func envName(key string) string {
+	return "NAMERCTL_" + strings.ToUpper(strings.Replace(key, "-", "_", -1))
+}
+
+// changedSetting returns the value given for setting key on the command
+// line, if any, in the form it is stored in the configuration file.
+func changedSetting(cmd *cobra.Command, key string) (interface{}, bool) {
+	switch key {
+	case "namespace":
+		flag := cmd.Flags().Lookup("namespace")
+		return setNamespace, flag != nil && flag.Changed
+	case "header":
+		return headerFlags, len(headerFlags) > 0
+	}
+
+	flag := RootCmd.PersistentFlags().Lookup(key)
+	if flag == nil || !flag.Changed {
+		return nil, false
+	}
+	switch flag.Value.Type() {
+	case "bool":
+		return flag.Value.String() == "true", true
+	case "int":
+		return viper.GetInt(key), true
+	default:
+		return flag.Value.String(), true
+	}
+}
+
+// withDefaultNamespace prepends the default namespace to args when a
+// command that takes a namespace first was given n-1 arguments.
+func withDefaultNamespace(args []string, n int) []string {
+	if len(args) == n-1 {
+		if ns := settings.GetString("namespace"); ns != "" {
+			return append([]string{ns}, args...)
+		}
+	}
+	return args
+}
+
+// readConfigFile reads the configuration file namerctl uses, or returns
+// the path of the file to create and an empty configuration if there is
+// none.
+func readConfigFile() (string, map[string]interface{}, error) {
+	path := viper.ConfigFileUsed()
+	if path == "" {
+		return defaultConfigFile, map[string]interface{}{}, nil
+	}
+	if err := checkConfigFormat(path); err != nil {
+		return "", nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return path, map[string]interface{}{}, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	// YAML is a superset of JSON, so both are read the same way.
+	config := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return "", nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return path, stringKeys(config).(map[string]interface{}), nil
+}
+
+// writeConfigFile writes config to path in the format of its extension.
+func writeConfigFile(path string, config map[string]interface{}) error {
+	if err := checkConfigFormat(path); err != nil {
+		return err
+	}
+	var data []byte
+	var err error
+	if filepath.Ext(path) == ".json" {
+		data, err = json.MarshalIndent(config, "", "  ")
+		data = append(data, '\n')
+	} else {
+		data, err = yaml.Marshal(config)
+	}
+	if err != nil {
+		return err
+	}
+	// The file may hold credentials.
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+func checkConfigFormat(path string) error {
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml", ".json":
+		return nil
+	default:
+		return fmt.Errorf("%s: contexts are only supported in YAML and JSON configuration files", path)
+	}
+}
+
+// configContexts returns the contexts of config by name.
+func configContexts(config map[string]interface{}) (map[string]map[string]interface{}, error) {
+	contexts := map[string]map[string]interface{}{}
+	raw, ok := config["contexts"]
+	if !ok || raw == nil {
+		return contexts, nil
+	}
+	byName, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("contexts must be a map from context names to settings")
+	}
+	for name, value := range byName {
+		settings, ok := value.(map[string]interface{})
+		if !ok && value != nil {
+			return nil, fmt.Errorf("context %s must be a map of settings", name)
+		}
+		if settings == nil {
+			settings = map[string]interface{}{}
+		}
+		contexts[name] = settings
+	}
+	return contexts, nil
+}
+
+// stringKeys converts the maps decoded by the yaml package, which may
+// have keys of any type, to maps with string keys.
+func stringKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			m[fmt.Sprint(key)] = stringKeys(elem)
+		}
+		return m
+	case map[string]interface{}:
+		for key, elem := range v {
+			v[key] = stringKeys(elem)
+		}
+		return v
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = stringKeys(elem)
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+func orEmpty(value interface{}) interface{} {
+	if value == nil {
+		return ""
+	}
+	return value
+}
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfig = `timeout: 10s
+current-context: dev
+contexts:
+  dev:
+    base-url: http://dev.example.com:4180
+    namespace: dev-ns
+    timeout: 5s
+  prod:
+    base-url: http://prod.example.com:4180
+    namespace: prod-ns
+`
+
+// writeConfig writes a configuration file named name in a new directory.
+func writeConfig(t *testing.T, name, config string) string {
+	dir := tempDir(t)
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+type settingstest struct {
+	name    string
+	config  string
+	env     map[string]string
+	args    []string
+	context string
+	baseURL string
+	ns      string
+	timeout time.Duration
+}
+
+var settingstests = []settingstest{
+	{"current context", testConfig, nil, nil,
+		"dev", "http://dev.example.com:4180", "dev-ns", 5 * time.Second},
+	{"context flag", testConfig, nil, []string{"--context", "prod"},
+		"prod", "http://prod.example.com:4180", "prod-ns", 10 * time.Second},
+	{"context env", testConfig, map[string]string{"NAMERCTL_CONTEXT": "prod"}, nil,
+		"prod", "http://prod.example.com:4180", "prod-ns", 10 * time.Second},
+	{"context flag over env", testConfig, map[string]string{"NAMERCTL_CONTEXT": "prod"}, []string{"--context", "dev"},
+		"dev", "http://dev.example.com:4180", "dev-ns", 5 * time.Second},
+	{"env over context", testConfig, map[string]string{"NAMERCTL_BASE_URL": "http://env:4180", "NAMERCTL_TIMEOUT": "1s"}, nil,
+		"dev", "http://env:4180", "dev-ns", time.Second},
+	{"flag over env", testConfig, map[string]string{"NAMERCTL_BASE_URL": "http://env:4180"},
+		[]string{"--base-url", "http://flag:4180", "--timeout", "2s"},
+		"dev", "http://flag:4180", "dev-ns", 2 * time.Second},
+	{"no contexts", "base-url: http://top:4180\n", nil, nil,
+		"", "http://top:4180", "", defaultTimeout},
+	{"defaults", "", nil, nil,
+		"", "", "", defaultTimeout},
+}
+
+func TestSettingsPrecedence(t *testing.T) {
+	for _, test := range settingstests {
+		path := writeConfig(t, ".namerctl.yaml", test.config)
+		defer os.RemoveAll(filepath.Dir(path))
+		for key, value := range test.env {
+			os.Setenv(key, value)
+		}
+
+		stdout, stderr, status := runNamerctl(t, path, append(test.args, "config", "current-context")...)
+		if test.context == "" {
+			expectOutput(t, test.name, stdout, stderr, status,
+				"", "no context is in use\nRun 'namerctl config current-context --help' for usage.\n", -1)
+		} else {
+			expectOutput(t, test.name, stdout, stderr, status, test.context+"\n", "", 0)
+		}
+
+		if contextErr != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, contextErr)
+		} else {
+			if baseURL := settings.GetString("base-url"); baseURL != test.baseURL {
+				t.Errorf("%s: expected base-url %s, got %s", test.name, test.baseURL, baseURL)
+			}
+			if ns := settings.GetString("namespace"); ns != test.ns {
+				t.Errorf("%s: expected namespace %s, got %s", test.name, test.ns, ns)
+			}
+			if timeout := settings.GetDuration("timeout"); timeout != test.timeout {
+				t.Errorf("%s: expected timeout %s, got %s", test.name, test.timeout, timeout)
+			}
+		}
+		for key := range test.env {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestUnknownContext(t *testing.T) {
+	path := writeConfig(t, ".namerctl.yaml", testConfig)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	stdout, stderr, status := runNamerctl(t, path, "--context", "nope", "dtab", "list")
+	expectOutput(t, "--context", stdout, stderr, status,
+		"", "no context named nope in "+path+"\nRun 'namerctl dtab list --help' for usage.\n", -1)
+
+	stdout, stderr, status = runNamerctl(t, path, "config", "use-context", "nope")
+	expectOutput(t, "use-context", stdout, stderr, status,
+		"", "no context named nope in "+path+"\nRun 'namerctl config use-context --help' for usage.\n", -1)
+
+	// The configuration file is left unchanged.
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != testConfig {
+		t.Errorf("expected the configuration file to be unchanged, got:\n%s", data)
+	}
+}
+
+func TestContextRoundTrip(t *testing.T) {
+	for name, empty := range map[string]string{".namerctl.yaml": "", ".namerctl.json": "{}"} {
+		path := writeConfig(t, name, empty)
+		defer os.RemoveAll(filepath.Dir(path))
+
+		stdout, stderr, status := runNamerctl(t, path, "config", "set-context", "staging",
+			"--base-url", "http://staging:4180", "--namespace", "web", "--header", "X-Team: a")
+		expectOutput(t, name+": create", stdout, stderr, status, "Created context staging in "+path+"\n", "", 0)
+		stdout, stderr, status = runNamerctl(t, path, "config", "set-context", "staging", "--timeout", "3s")
+		expectOutput(t, name+": update", stdout, stderr, status, "Updated context staging in "+path+"\n", "", 0)
+		stdout, stderr, status = runNamerctl(t, path, "config", "set-context", "staging")
+		expectOutput(t, name+": no settings", stdout, stderr, status,
+			"", "no settings given; see 'namerctl config set-context --help'\n"+
+				"Run 'namerctl config set-context --help' for usage.\n", -1)
+
+		stdout, stderr, status = runNamerctl(t, path, "config", "use-context", "staging")
+		expectOutput(t, name+": use-context", stdout, stderr, status, "Switched to context staging\n", "", 0)
+		stdout, stderr, status = runNamerctl(t, path, "config", "get-contexts")
+		expectOutput(t, name+": get-contexts", stdout, stderr, status,
+			"CURRENT  NAME     BASE-URL             NAMESPACE\n"+
+				"*        staging  http://staging:4180  web\n", "", 0)
+
+		// The settings are read back from the file.
+		stdout, stderr, status = runNamerctl(t, path, "config", "current-context")
+		expectOutput(t, name+": current-context", stdout, stderr, status, "staging\n", "", 0)
+		if baseURL := settings.GetString("base-url"); baseURL != "http://staging:4180" {
+			t.Errorf("%s: expected base-url http://staging:4180, got %s", name, baseURL)
+		}
+		if timeout := settings.GetDuration("timeout"); timeout != 3*time.Second {
+			t.Errorf("%s: expected timeout 3s, got %s", name, timeout)
+		}
+		if headers := settings.GetStringSlice("header"); len(headers) != 1 || headers[0] != "X-Team: a" {
+			t.Errorf("%s: expected header [X-Team: a], got %q", name, headers)
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "current-context") {
+			t.Errorf("%s: expected current-context to be written, got:\n%s", name, data)
+		}
+	}
+}
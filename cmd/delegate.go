@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/linkerd/namerctl/namer"
+	"github.com/spf13/cobra"
+)
+
+var (
+	delegateOverlay = ""
+
+	delegateCmd = &cobra.Command{
+		Use:   "delegate [namespace] [path]",
+		Short: "Show how namerd delegates a path",
+		Long: `Show how namerd delegates a path.
+
+namerd delegates the path through the namespace's delegation table and
+reports each step, as its admin interface's delegator does. The tree is
+printed with one node per line, each annotated with the dentry that
+produced it. Leaves show the name bound by namerd's namers and how many
+addresses it has, and negative branches show where delegation found
+nothing.
+
+With --dtab, the given dentries are added to the namespace's delegation
+table for this request only, as a request's l5d-dtab header would be.
+
+'namerctl dtab delegate' shows the same tree without contacting namerd's
+namers, or offline for a dtab file.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			args = withDefaultNamespace(args, 2)
+			switch len(args) {
+			case 2:
+				ctl, err := getController()
+				if err != nil {
+					return err
+				}
+				delegator, ok := ctl.(namer.Delegator)
+				if !ok {
+					return &namer.ErrUnsupported{Operation: "delegating names"}
+				}
+				path, err := namer.ParsePath(args[1])
+				if err != nil {
+					return fmt.Errorf("invalid path '%s': %s", args[1], err)
+				}
+				overlay, err := parseOverlay(delegateOverlay)
+				if err != nil {
+					return err
+				}
+
+				tree, err := delegator.Delegate(cmdContext, args[0], path, overlay)
+				if err != nil {
+					return err
+				}
+				if jsonOutput {
+					bytes, err := json.Marshal(tree)
+					if err != nil {
+						return err
+					}
+					fmt.Println(string(bytes))
+				} else {
+					printDelegateTree(os.Stdout, tree)
+					fmt.Printf("\nresult: %s\n", tree.Result())
+				}
+				return nil
+
+			default:
+				return errors.New("delegate requires a namespace and a path")
+			}
+		},
+	}
+)
+
+func init() {
+	delegateCmd.PersistentFlags().StringVar(&delegateOverlay, "dtab", "",
+		"dentries to add to the namespace's dtab for this request")
+	delegateCmd.PersistentFlags().BoolVar(&jsonOutput, "json", false, "output in json instead of text")
+	RootCmd.AddCommand(delegateCmd)
+}
@@ -23,6 +23,12 @@ var (
 		Use:     "list",
 		Aliases: []string{"ls"},
 		Short:   "List delegation table names",
+		Long: `List delegation table names.
+
+With --watch, each existing delegation table is reported as ADDED, and
+then each one created or deleted afterwards as ADDED or REMOVED, until
+namerctl is interrupted. With --json, each event is printed as a JSON
+object on its own line.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			switch len(args) {
 			case 0:
@@ -30,7 +36,10 @@ var (
 				if err != nil {
 					return err
 				}
-				names, err := ctl.List()
+				if dtabListWatch {
+					return watchDtabList(ctl)
+				}
+				names, err := namer.ListContext(cmdContext, ctl)
 				if err != nil {
 					return err
 				}
@@ -52,6 +61,8 @@ var (
 		},
 	}
 
+	dtabListWatch = false
+
 	dtabGetPretty = true
 	dtabJson      = false
 
@@ -60,14 +71,22 @@ var (
 		Aliases: []string{"cat"},
 		Short:   "Get a delegation table by name",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			args = withDefaultNamespace(args, 1)
 			switch len(args) {
 			case 1:
+				name := args[0]
+				targets, err := getTargets()
+				if err != nil {
+					return err
+				}
+				if targets != nil {
+					return printTargetDtabs(runTargets(targets, getOp(name)))
+				}
 				ctl, err := getController()
 				if err != nil {
 					return err
 				}
-				name := args[0]
-				vd, err := ctl.Get(name)
+				vd, err := namer.GetContext(cmdContext, ctl, name)
 				if err != nil {
 					return err
 				}
@@ -101,16 +120,26 @@ var (
 		RunE: func(cmd *cobra.Command, args []string) error {
 			switch len(args) {
 			case 2:
-				ctl, err := getController()
+				name := args[0]
+				dtabstr, err := readDtabPath(args[1])
 				if err != nil {
 					return err
 				}
-				name := args[0]
-				dtabstr, err := readDtabPath(args[1])
+				if _, err = validateDtab(args[1], dtabstr); err != nil {
+					return err
+				}
+				targets, err := getTargets()
 				if err != nil {
 					return err
 				}
-				_, err = ctl.Create(name, dtabstr)
+				if targets != nil {
+					return reportTargets(runTargets(targets, createOp(name, dtabstr)))
+				}
+				ctl, err := getController()
+				if err != nil {
+					return err
+				}
+				_, err = namer.CreateContext(cmdContext, ctl, name, dtabstr)
 				if err != nil {
 					return err
 				}
@@ -132,16 +161,29 @@ var (
 		RunE: func(cmd *cobra.Command, args []string) error {
 			switch len(args) {
 			case 2:
-				ctl, err := getController()
+				name := args[0]
+				dtabstr, err := readDtabPath(args[1])
 				if err != nil {
 					return err
 				}
-				name := args[0]
-				dtabstr, err := readDtabPath(args[1])
+				if _, err = validateDtab(args[1], dtabstr); err != nil {
+					return err
+				}
+				targets, err := getTargets()
+				if err != nil {
+					return err
+				}
+				if targets != nil {
+					if dtabUpdateVersion != "" {
+						return errors.New("--version cannot be used with --contexts or --all-contexts")
+					}
+					return reportTargets(runTargets(targets, updateOp(name, dtabstr)))
+				}
+				ctl, err := getController()
 				if err != nil {
 					return err
 				}
-				_, err = ctl.Update(name, dtabstr, namer.Version(dtabUpdateVersion))
+				_, err = namer.UpdateContext(cmdContext, ctl, name, dtabstr, namer.Version(dtabUpdateVersion))
 				if err != nil {
 					return err
 				}
@@ -160,12 +202,19 @@ var (
 		RunE: func(cmd *cobra.Command, args []string) error {
 			switch len(args) {
 			case 1:
+				name := args[0]
+				targets, err := getTargets()
+				if err != nil {
+					return err
+				}
+				if targets != nil {
+					return reportTargets(runTargets(targets, deleteOp(name)))
+				}
 				ctl, err := getController()
 				if err != nil {
 					return err
 				}
-				name := args[0]
-				if err = ctl.Delete(name); err != nil {
+				if err = namer.DeleteContext(cmdContext, ctl, name); err != nil {
 					return err
 				}
 				fmt.Printf("Deleted %s\n", name)
@@ -181,22 +230,60 @@ var (
 func init() {
 	dtabCmd.PersistentFlags().BoolVar(&dtabJson, "json", false, "input/output in json instead of text")
 
+	dtabListCmd.PersistentFlags().BoolVar(&dtabListWatch, "watch", false,
+		"report delegation tables as they are created and deleted")
 	dtabCmd.AddCommand(dtabListCmd)
 
 	dtabGetCmd.PersistentFlags().BoolVar(&dtabGetPretty, "pretty", true, "pretty-print dtabs")
+	addTargetFlags(dtabGetCmd, false)
 	dtabCmd.AddCommand(dtabGetCmd)
 
+	addTargetFlags(dtabCreateCmd, true)
 	dtabCmd.AddCommand(dtabCreateCmd)
 
 	dtabUpdateCmd.PersistentFlags().StringVar(&dtabUpdateVersion, "version", "",
 		"only perform update if the current version matches")
+	addTargetFlags(dtabUpdateCmd, true)
 	dtabCmd.AddCommand(dtabUpdateCmd)
 
+	addTargetFlags(dtabDeleteCmd, true)
 	dtabCmd.AddCommand(dtabDeleteCmd)
 
 	RootCmd.AddCommand(dtabCmd)
 }
 
+// watchDtabList prints the events of a WatchList until it ends.
+func watchDtabList(ctl namer.Controller) error {
+	watcher, ok := ctl.(namer.ListWatcher)
+	if !ok {
+		return &namer.ErrUnsupported{Operation: "watching the list of dtabs"}
+	}
+	events, err := watcher.WatchList(cmdContext)
+	if err != nil {
+		return err
+	}
+	for event := range events {
+		if dtabJson {
+			bytes, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(bytes))
+		} else {
+			fmt.Printf("%-7s %s\n", event.Type, event.Name)
+		}
+	}
+	if cmdContext.Err() != nil {
+		return nil
+	}
+
+	// The watch ended on its own; find out why.
+	if _, err := namer.ListContext(cmdContext, ctl); err != nil {
+		return err
+	}
+	return errors.New("watch of dtab names ended")
+}
+
 func readDtabPath(path string) (string, error) {
 	var file io.Reader
 	var err error
@@ -217,3 +304,57 @@ func readDtabPath(path string) (string, error) {
 	}
 	return string(bytes), nil
 }
+
+// validateDtab parses a dtab read by readDtabPath so that syntax errors
+// are reported, with their positions, before anything is sent to namerd.
+// Unlike dtab lint, it rejects a prefix with a trailing slash, which
+// namerd refuses.
+func validateDtab(path, dtabstr string) (namer.Dtab, error) {
+	if isJSONDtab(dtabstr) {
+		dtab, err := decodeJSONDtab(path, dtabstr)
+		if err != nil {
+			return nil, err
+		}
+		for i, dentry := range dtab {
+			if dentry.Prefix.TrailingSlash() {
+				return nil, fmt.Errorf("%s: dentry %d: prefix %s must not end with '/'",
+					dtabFilename(path), i, dentry.Prefix)
+			}
+		}
+		return dtab, nil
+	}
+
+	dtab, err := namer.ValidateDtabFile(dtabFilename(path), dtabstr)
+	if errs, ok := err.(namer.ErrorList); ok {
+		msgs := make([]string, len(errs))
+		for i, e := range errs {
+			msgs[i] = fmt.Sprintf("%s\n%s", e, e.Excerpt())
+		}
+		return nil, fmt.Errorf("invalid dtab:\n%s", strings.Join(msgs, "\n"))
+	}
+	return dtab, err
+}
+
+// decodeJSONDtab decodes a dtab in namerd's JSON representation. Like
+// namer.ParseDtabFile, it keeps prefixes with a trailing slash.
+func decodeJSONDtab(path, dtabstr string) (namer.Dtab, error) {
+	var vdtab namer.VersionedDtab
+	if err := json.Unmarshal([]byte(dtabstr), &vdtab); err != nil {
+		return nil, fmt.Errorf("%s: %s", dtabFilename(path), err)
+	}
+	return vdtab.Dtab, nil
+}
+
+// isJSONDtab reports whether dtabstr is in namerd's JSON representation,
+// the same way the namer package decides how to send it.
+func isJSONDtab(dtabstr string) bool {
+	return strings.HasPrefix(dtabstr, "{") || strings.HasPrefix(dtabstr, "[")
+}
+
+// dtabFilename names a readDtabPath path in error messages.
+func dtabFilename(path string) string {
+	if path == "-" {
+		return "<stdin>"
+	}
+	return path
+}
@@ -0,0 +1,452 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/linkerd/namerctl/namer"
+	"github.com/spf13/cobra"
+)
+
+// The actions of an apply plan.
+const (
+	applyCreate    = "create"
+	applyUpdate    = "update"
+	applyDelete    = "delete"
+	applyUnchanged = "unchanged"
+)
+
+// namespaceDirective names the namespace of a document read from stdin.
+const namespaceDirective = "# namespace:"
+
+type (
+	// localDtab is a dtab to be applied to a namespace.
+	localDtab struct {
+		Namespace string
+		Source    string
+		Dtab      namer.Dtab
+	}
+
+	// applyStep is one namespace of an apply plan.
+	applyStep struct {
+		Namespace string              `json:"namespace"`
+		Action    string              `json:"action"`
+		Source    string              `json:"source,omitempty"`
+		Version   namer.Version       `json:"version,omitempty"`
+		Changes   []*namer.DtabChange `json:"changes,omitempty"`
+
+		dtab namer.Dtab
+		// diff also holds the unchanged dentries, for context.
+		diff []*namer.DtabChange
+		// previous is namerd's dtab before an update or delete, to roll
+		// the step back.
+		previous namer.Dtab
+	}
+)
+
+var (
+	dtabApplyFilename = ""
+	dtabApplyPrune    = false
+	dtabApplyDryRun   = false
+
+	dtabApplyCmd = &cobra.Command{
+		Use:   "apply -f <dir|file|->",
+		Short: "Make namerd's delegation tables match local files",
+		Long: `Make namerd's delegation tables match local files.
+
+With a directory, each *.dtab or *.json file in it is the delegation
+table of the namespace named after the file, so that prod.dtab is
+applied to the prod namespace. A single file is applied the same way.
+
+With -, several dtabs are read from stdin, separated by lines holding
+only "---". Each must name its namespace with a comment:
+
+  # namespace: prod
+  /svc => /#/io.l5d.fs ;
+
+Missing namespaces are created and existing ones are updated when their
+dentries differ. With --prune, namespaces that have no local dtab are
+deleted. The plan is printed before it is applied; with --dry-run,
+nothing is changed. Steps are applied in order, stopping at the first
+failure; with --atomic, the steps already applied are then rolled back.
+
+With --contexts or --all-contexts, the plan for each context is printed
+and then applied to every context concurrently.`,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return errors.New("apply does not take arguments; use -f")
+			}
+			if dtabApplyFilename == "" {
+				return errors.New("apply requires -f with a directory, file or -")
+			}
+
+			locals, err := readLocalDtabs(dtabApplyFilename)
+			if err != nil {
+				return err
+			}
+			if len(locals) == 0 && dtabApplyPrune {
+				return fmt.Errorf("no dtabs found in %s; refusing to prune every namespace",
+					dtabFilename(dtabApplyFilename))
+			}
+
+			targets, err := getTargets()
+			if err != nil {
+				return err
+			}
+			if targets != nil {
+				return applyTargets(targets, locals)
+			}
+
+			ctl, err := getController()
+			if err != nil {
+				return err
+			}
+			plan, err := planApply(ctl, locals, dtabApplyPrune)
+			if err != nil {
+				return err
+			}
+
+			if dtabJson {
+				bytes, err := json.Marshal(plan)
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(bytes))
+			} else {
+				printApplyPlan(plan)
+			}
+			if dtabApplyDryRun {
+				return nil
+			}
+			undo, err := executeApply(ctl, plan, !dtabJson)
+			if err != nil && dtabAtomic && undo != nil {
+				if undoErr := undo(); undoErr != nil {
+					return annotate(err, "%s; rollback failed: %s", err, undoErr)
+				}
+				if !dtabJson {
+					fmt.Println("Rolled back")
+				}
+			}
+			return err
+		},
+	}
+)
+
+func init() {
+	dtabApplyCmd.PersistentFlags().StringVarP(&dtabApplyFilename, "filename", "f", "",
+		"directory or file of dtabs to apply, or - for stdin")
+	dtabApplyCmd.PersistentFlags().BoolVar(&dtabApplyPrune, "prune", false,
+		"delete namespaces that have no local dtab")
+	dtabApplyCmd.PersistentFlags().BoolVar(&dtabApplyDryRun, "dry-run", false,
+		"print the plan without applying it")
+	addTargetFlags(dtabApplyCmd, true)
+	dtabCmd.AddCommand(dtabApplyCmd)
+}
+
+// readLocalDtabs reads and validates the dtabs at path, sorted by
+// namespace.
+func readLocalDtabs(path string) ([]*localDtab, error) {
+	var locals []*localDtab
+	var err error
+	if path == "-" {
+		locals, err = readDtabDocuments(path)
+	} else if info, statErr := os.Stat(path); statErr != nil {
+		return nil, statErr
+	} else if info.IsDir() {
+		locals, err = readDtabDir(path)
+	} else {
+		var local *localDtab
+		local, err = readLocalDtab(path)
+		locals = []*localDtab{local}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(locals, func(i, j int) bool {
+		return locals[i].Namespace < locals[j].Namespace
+	})
+	for i := 1; i < len(locals); i++ {
+		if locals[i].Namespace == locals[i-1].Namespace {
+			return nil, fmt.Errorf("namespace %s is defined by both %s and %s",
+				locals[i].Namespace, locals[i-1].Source, locals[i].Source)
+		}
+	}
+	return locals, nil
+}
+
+func readDtabDir(dir string) ([]*localDtab, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	locals := []*localDtab{}
+	for _, info := range infos {
+		ext := filepath.Ext(info.Name())
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") || (ext != ".dtab" && ext != ".json") {
+			continue
+		}
+		local, err := readLocalDtab(filepath.Join(dir, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+		locals = append(locals, local)
+	}
+	return locals, nil
+}
+
+func readLocalDtab(path string) (*localDtab, error) {
+	dtabstr, err := readDtabPath(path)
+	if err != nil {
+		return nil, err
+	}
+	dtab, err := validateDtab(path, dtabstr)
+	if err != nil {
+		return nil, err
+	}
+	base := filepath.Base(path)
+	return &localDtab{
+		Namespace: strings.TrimSuffix(base, filepath.Ext(base)),
+		Source:    path,
+		Dtab:      dtab,
+	}, nil
+}
+
+// readDtabDocuments reads dtabs separated by "---" lines, each naming its
+// namespace with a "# namespace: <name>" comment.
+func readDtabDocuments(path string) ([]*localDtab, error) {
+	src, err := readDtabPath(path)
+	if err != nil {
+		return nil, err
+	}
+	docs := [][]string{{}}
+	for _, line := range strings.Split(src, "\n") {
+		if strings.TrimSpace(line) == "---" {
+			docs = append(docs, []string{})
+			continue
+		}
+		docs[len(docs)-1] = append(docs[len(docs)-1], line)
+	}
+
+	locals := []*localDtab{}
+	for i, lines := range docs {
+		namespace := ""
+		for _, line := range lines {
+			if strings.HasPrefix(line, namespaceDirective) {
+				namespace = strings.TrimSpace(strings.TrimPrefix(line, namespaceDirective))
+				break
+			}
+		}
+		text := strings.Join(lines, "\n")
+		if namespace == "" {
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+			return nil, fmt.Errorf("%s: document %d has no '%s' comment",
+				dtabFilename(path), i+1, namespaceDirective)
+		}
+
+		source := fmt.Sprintf("%s (%s)", dtabFilename(path), namespace)
+		dtab, err := validateDtab(source, text)
+		if err != nil {
+			return nil, err
+		}
+		locals = append(locals, &localDtab{Namespace: namespace, Source: source, Dtab: dtab})
+	}
+	return locals, nil
+}
+
+// planApply compares locals with namerd's dtabs.
+func planApply(ctl namer.Controller, locals []*localDtab, prune bool) ([]*applyStep, error) {
+	names, err := namer.ListContext(cmdContext, ctl)
+	if err != nil {
+		return nil, err
+	}
+	remote := map[string]bool{}
+	for _, name := range names {
+		remote[name] = true
+	}
+
+	plan := []*applyStep{}
+	local := map[string]bool{}
+	for _, l := range locals {
+		local[l.Namespace] = true
+		step := &applyStep{Namespace: l.Namespace, Source: l.Source, dtab: l.Dtab}
+		if !remote[l.Namespace] {
+			step.Action = applyCreate
+			plan = append(plan, step)
+			continue
+		}
+
+		vd, err := namer.GetContext(cmdContext, ctl, l.Namespace)
+		if err != nil {
+			return nil, annotate(err, "%s: %s", l.Namespace, err)
+		}
+		step.Version = vd.Version
+		step.previous = vd.Dtab
+		step.diff = namer.DiffDtabs(vd.Dtab, l.Dtab)
+		if namer.HasChanges(step.diff) {
+			step.Action = applyUpdate
+			for _, c := range step.diff {
+				if c.Type != namer.ChangeUnchanged {
+					step.Changes = append(step.Changes, c)
+				}
+			}
+		} else {
+			step.Action = applyUnchanged
+		}
+		plan = append(plan, step)
+	}
+
+	if prune {
+		sort.Strings(names)
+		for _, name := range names {
+			if !local[name] {
+				plan = append(plan, &applyStep{Namespace: name, Action: applyDelete})
+			}
+		}
+	}
+	return plan, nil
+}
+
+// applyTargets plans and applies locals on each target.
+func applyTargets(targets []*target, locals []*localDtab) error {
+	results := runTargets(targets, func(t *target, result *targetResult) error {
+		plan, err := planApply(t.ctl, locals, dtabApplyPrune)
+		if err != nil {
+			return err
+		}
+		result.Plan = plan
+		counts := applyCounts(plan)
+		result.Result = fmt.Sprintf("%d to create, %d to update, %d to delete, %d unchanged",
+			counts[applyCreate], counts[applyUpdate], counts[applyDelete], counts[applyUnchanged])
+		return nil
+	})
+	if failedTargets(results) > 0 || (dtabApplyDryRun && dtabJson) {
+		return reportTargets(results)
+	}
+	plans := map[*target][]*applyStep{}
+	for i, t := range targets {
+		plans[t] = results[i].Plan
+		if !dtabJson {
+			fmt.Printf("# context %s\n", t.Context)
+			printApplyPlan(results[i].Plan)
+		}
+	}
+	if dtabApplyDryRun {
+		return nil
+	}
+
+	results = runTargets(targets, func(t *target, result *targetResult) error {
+		result.Plan = plans[t]
+		undo, err := executeApply(t.ctl, plans[t], false)
+		result.undo = undo
+		if err != nil {
+			return err
+		}
+		counts := applyCounts(plans[t])
+		result.Result = fmt.Sprintf("%d created, %d updated, %d deleted",
+			counts[applyCreate], counts[applyUpdate], counts[applyDelete])
+		return nil
+	})
+	return reportTargets(results)
+}
+
+func applyCounts(plan []*applyStep) map[string]int {
+	counts := map[string]int{}
+	for _, step := range plan {
+		counts[step.Action]++
+	}
+	return counts
+}
+
+func printApplyPlan(plan []*applyStep) {
+	for _, step := range plan {
+		switch step.Action {
+		case applyCreate:
+			fmt.Printf("create %s from %s\n", step.Namespace, step.Source)
+		case applyUpdate:
+			fmt.Printf("update %s from %s\n", step.Namespace, step.Source)
+			printDtabDiff(os.Stdout, fmt.Sprintf("namerd:%s (version %s)", step.Namespace, step.Version),
+				step.Source, step.diff, isTerminal(os.Stdout))
+		case applyDelete:
+			fmt.Printf("delete %s\n", step.Namespace)
+		case applyUnchanged:
+			fmt.Printf("unchanged %s\n", step.Namespace)
+		}
+	}
+	counts := applyCounts(plan)
+	fmt.Printf("Plan: %d to create, %d to update, %d to delete, %d unchanged.\n",
+		counts[applyCreate], counts[applyUpdate], counts[applyDelete], counts[applyUnchanged])
+}
+
+// executeApply carries out plan, stopping at the first failure. It
+// returns a function that undoes the steps carried out, even if a later
+// step failed, or nil if none was. Undoing runs on a context of its own,
+// so that it still works once namerctl was interrupted.
+func executeApply(ctl namer.Controller, plan []*applyStep, report bool) (func() error, error) {
+	done := []*applyStep{}
+	versions := map[*applyStep]namer.Version{}
+	undo := func() error {
+		ctx, cancel := rollbackContext()
+		defer cancel()
+		var first error
+		for i := len(done) - 1; i >= 0; i-- {
+			step := done[i]
+			var err error
+			switch step.Action {
+			case applyCreate:
+				err = namer.DeleteContext(ctx, ctl, step.Namespace)
+			case applyUpdate:
+				if versions[step] == "" {
+					err = errNoVersion
+				} else {
+					_, err = namer.UpdateContext(ctx, ctl, step.Namespace, step.previous.String(), versions[step])
+				}
+			case applyDelete:
+				_, err = namer.CreateContext(ctx, ctl, step.Namespace, step.previous.String())
+			}
+			if err != nil && first == nil {
+				first = annotate(err, "undo %s %s: %s", step.Action, step.Namespace, err)
+			}
+		}
+		return first
+	}
+
+	for _, step := range plan {
+		var err error
+		switch step.Action {
+		case applyCreate:
+			_, err = namer.CreateContext(cmdContext, ctl, step.Namespace, step.dtab.String())
+		case applyUpdate:
+			versions[step], err = namer.UpdateContext(cmdContext, ctl, step.Namespace, step.dtab.String(), step.Version)
+		case applyDelete:
+			var vd *namer.VersionedDtab
+			if vd, err = namer.GetContext(cmdContext, ctl, step.Namespace); err == nil {
+				step.previous = vd.Dtab
+				err = namer.DeleteContext(cmdContext, ctl, step.Namespace)
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			if len(done) == 0 {
+				undo = nil
+			}
+			return undo, annotate(err, "%s %s: %s", step.Action, step.Namespace, err)
+		}
+		done = append(done, step)
+		if report {
+			fmt.Printf("%sd %s\n", strings.ToUpper(step.Action[:1])+step.Action[1:], step.Namespace)
+		}
+	}
+	return undo, nil
+}
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type applytest struct {
+	name   string
+	remote map[string]string
+	// local maps file names to their contents.
+	local map[string]string
+	prune bool
+	plan  []string
+	// concurrent is written to namerd after the plan was made.
+	concurrent map[string]string
+	err        string
+	after      map[string]string
+	// undone is what namerd holds once the apply is undone.
+	undone map[string]string
+}
+
+var applytests = []applytest{
+	{
+		"sync",
+		map[string]string{"changed": "/a=>/b", "same": "/a=>/b", "extra": "/x=>/y"},
+		map[string]string{"changed.dtab": "/a => /c;\n", "same.dtab": "# no changes\n/a => /b;\n", "new.json": `{"dtab":[{"prefix":"/n","dst":"/m"}]}`},
+		false,
+		[]string{"update changed", "create new", "unchanged same"},
+		nil, "",
+		map[string]string{"changed": "/a=>/c;", "same": "/a=>/b;", "new": "/n=>/m;", "extra": "/x=>/y;"},
+		map[string]string{"changed": "/a=>/b;", "same": "/a=>/b;", "extra": "/x=>/y;"},
+	},
+	{
+		"prune",
+		map[string]string{"keep": "/a=>/b", "extra": "/x=>/y"},
+		map[string]string{"keep.dtab": "/a=>/b"},
+		true,
+		[]string{"unchanged keep", "delete extra"},
+		nil, "",
+		map[string]string{"keep": "/a=>/b;"},
+		map[string]string{"keep": "/a=>/b;", "extra": "/x=>/y;"},
+	},
+	{
+		"version conflict",
+		map[string]string{"b-changed": "/a=>/b"},
+		map[string]string{"a-new.dtab": "/n=>/m", "b-changed.dtab": "/a=>/c"},
+		false,
+		[]string{"create a-new", "update b-changed"},
+		map[string]string{"b-changed": "/a=>/d"},
+		"update b-changed: resource was modified since it was fetched",
+		// The steps before the conflict are kept.
+		map[string]string{"a-new": "/n=>/m;", "b-changed": "/a=>/d;"},
+		// Undoing keeps the concurrent change.
+		map[string]string{"b-changed": "/a=>/d;"},
+	},
+	{
+		"deleted concurrently",
+		map[string]string{"ns": "/a=>/b"},
+		map[string]string{"ns.dtab": "/a=>/c"},
+		false,
+		[]string{"update ns"},
+		map[string]string{},
+		"update ns: resource was not found by ID or name",
+		map[string]string{},
+		map[string]string{},
+	},
+}
+
+func TestApply(t *testing.T) {
+	defer func(ctx context.Context, cancel context.CancelFunc) {
+		cmdContext, cancelCommand = ctx, cancel
+	}(cmdContext, cancelCommand)
+	for _, test := range applytests {
+		cmdContext, cancelCommand = context.WithCancel(context.Background())
+		ctl := newTestController(t, test.remote)
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+		for name, contents := range test.local {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		locals, err := readLocalDtabs(dir)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+
+		plan, err := planApply(ctl, locals, test.prune)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		actions := []string{}
+		for _, step := range plan {
+			actions = append(actions, step.Action+" "+step.Namespace)
+		}
+		if len(actions) != len(test.plan) {
+			t.Errorf("%s: expected plan %q, got %q", test.name, test.plan, actions)
+			continue
+		}
+		for i := range actions {
+			if actions[i] != test.plan[i] {
+				t.Errorf("%s: expected plan %q, got %q", test.name, test.plan, actions)
+				break
+			}
+		}
+
+		if test.concurrent != nil {
+			for name := range test.remote {
+				if dtabstr, ok := test.concurrent[name]; ok {
+					ctl.Update(name, dtabstr, "")
+				} else {
+					ctl.Delete(name)
+				}
+			}
+		}
+		undo, err := executeApply(ctl, plan, false)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+		case test.err != "" && (err == nil || err.Error() != test.err):
+			t.Errorf("%s: expected error '%s', got '%v'", test.name, test.err, err)
+		}
+		expectDtabs(t, test.name, ctl, test.after)
+
+		if test.err == "" {
+			// Applying again changes nothing.
+			again, err := planApply(ctl, locals, test.prune)
+			if err != nil {
+				t.Errorf("%s: %s", test.name, err)
+				continue
+			}
+			for _, step := range again {
+				if step.Action != applyUnchanged {
+					t.Errorf("%s: expected %s to be unchanged after the apply, got %s", test.name, step.Namespace, step.Action)
+				}
+			}
+		}
+
+		// The apply is undone as it would be after an interrupt. undo is
+		// nil when no step was carried out.
+		cancelCommand()
+		if undo != nil {
+			if err := undo(); err != nil {
+				t.Errorf("%s: undo: %s", test.name, err)
+			}
+		}
+		expectDtabs(t, test.name+": undo", ctl, test.undone)
+	}
+}
+
+func TestReadLocalDtabsDuplicate(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	for name, contents := range map[string]string{"web.dtab": "/a=>/b", "web.json": `{"dtab":[]}`} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := readLocalDtabs(dir)
+	expected := "namespace web is defined by both " + filepath.Join(dir, "web.dtab") + " and " + filepath.Join(dir, "web.json")
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error '%s', got '%v'", expected, err)
+	}
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/linkerd/namerctl/namer"
+	"github.com/spf13/cobra"
+)
+
+var (
+	dtabDelegateOffline = false
+
+	dtabDelegateCmd = &cobra.Command{
+		Use:   "delegate [name] [path]",
+		Short: "Show how a path is delegated by a delegation table",
+		Long: `Show how a path is delegated by a delegation table.
+
+Delegation is simulated locally with Finagle's semantics: later dentries
+take precedence, alternates fall back while a branch is negative, and
+delegation stops at namer paths (/#/... and /$/...), which are shown as
+leaves without being bound.
+
+By default the named delegation table is fetched from namerd. With
+--offline, the first argument is instead a dtab file (or - for stdin)
+and namerd is not contacted. To see how namerd itself delegates a path,
+including how its namers bind it, use 'namerctl delegate'.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch len(args) {
+			case 2:
+				var dtab namer.Dtab
+				if dtabDelegateOffline {
+					dtabstr, err := readDtabPath(args[0])
+					if err != nil {
+						return err
+					}
+					dtab, err = validateDtab(args[0], dtabstr)
+					if err != nil {
+						return err
+					}
+				} else {
+					ctl, err := getController()
+					if err != nil {
+						return err
+					}
+					vd, err := namer.GetContext(cmdContext, ctl, args[0])
+					if err != nil {
+						return err
+					}
+					dtab = vd.Dtab
+				}
+
+				path, err := namer.ParsePath(args[1])
+				if err != nil {
+					return fmt.Errorf("invalid path '%s': %s", args[1], err)
+				}
+				tree := dtab.Delegate(path)
+
+				if dtabJson {
+					bytes, err := json.Marshal(tree)
+					if err != nil {
+						return err
+					}
+					fmt.Println(string(bytes))
+				} else {
+					printDelegateTree(os.Stdout, tree)
+					fmt.Printf("\nresult: %s\n", tree.Result())
+				}
+				return nil
+
+			default:
+				return errors.New("delegate requires a name (or file) and a path")
+			}
+		},
+	}
+)
+
+func init() {
+	dtabDelegateCmd.PersistentFlags().BoolVar(&dtabDelegateOffline, "offline", false,
+		"read the dtab from a file instead of namerd")
+	dtabCmd.AddCommand(dtabDelegateCmd)
+}
+
+// printDelegateTree draws tree with one node per line, each annotated
+// with the dentry that produced it.
+func printDelegateTree(w io.Writer, tree *namer.DelegateTree) {
+	fmt.Fprintln(w, delegateNodeLabel(tree))
+	printDelegateChildren(w, tree, "")
+}
+
+func printDelegateChildren(w io.Writer, tree *namer.DelegateTree, indent string) {
+	children := []*namer.DelegateTree{}
+	weights := []string{}
+	switch tree.Type {
+	case namer.DelegateTypeDelegate, namer.DelegateTypeTransformation:
+		if tree.Delegate != nil {
+			children = append(children, tree.Delegate)
+			weights = append(weights, "")
+		}
+	case namer.DelegateTypeAlt:
+		for _, child := range tree.Alt {
+			children = append(children, child)
+			weights = append(weights, "")
+		}
+	case namer.DelegateTypeUnion:
+		for _, w := range tree.Union {
+			children = append(children, w.Tree)
+			weights = append(weights, fmt.Sprintf("%g * ", w.Weight))
+		}
+	}
+
+	for i, child := range children {
+		branch, next := "|-- ", "|   "
+		if i == len(children)-1 {
+			branch, next = "`-- ", "    "
+		}
+		fmt.Fprintf(w, "%s%s%s%s\n", indent, branch, weights[i], delegateNodeLabel(child))
+		printDelegateChildren(w, child, indent+next)
+	}
+}
+
+func delegateNodeLabel(tree *namer.DelegateTree) string {
+	var label string
+	switch tree.Type {
+	case namer.DelegateTypeDelegate:
+		label = tree.Path.String()
+	case namer.DelegateTypeLeaf:
+		label = tree.Path.String()
+		if tree.Bound != nil {
+			if tree.Bound.ID.String() != tree.Path.String() {
+				label += fmt.Sprintf(" => bound %s", tree.Bound.ID)
+			}
+			if len(tree.Bound.Path) > 0 {
+				label += fmt.Sprintf(" (residual %s)", tree.Bound.Path)
+			}
+			if tree.Bound.Addr != nil {
+				label += fmt.Sprintf(" (%s)", addrSummary(tree.Bound.Addr))
+			}
+		}
+	case namer.DelegateTypeTransformation:
+		label = fmt.Sprintf("%s => transformed by %s", tree.Path, tree.Name)
+	case namer.DelegateTypeAlt:
+		label = "| alternates"
+	case namer.DelegateTypeUnion:
+		label = "& union"
+	case namer.DelegateTypeNeg:
+		label = "~ negative"
+	case namer.DelegateTypeFail:
+		label = "! fail"
+	case namer.DelegateTypeEmpty:
+		label = "$ empty"
+	case namer.DelegateTypeException:
+		label = "! error: " + tree.Message
+	default:
+		label = tree.Type
+	}
+	if tree.Dentry != nil {
+		label += fmt.Sprintf("  [%s => %s]", tree.Dentry.Prefix, tree.Dentry.Destination)
+	}
+	return label
+}
@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/linkerd/namerctl/namer"
+	"github.com/spf13/cobra"
+)
+
+// ANSI escapes used by colored diffs.
+const (
+	colorReset  = "\x1b[0m"
+	colorBold   = "\x1b[1m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorCyan   = "\x1b[36m"
+)
+
+type dtabDiffResult struct {
+	From    string              `json:"from"`
+	To      string              `json:"to"`
+	Changes []*namer.DtabChange `json:"changes"`
+}
+
+var (
+	dtabDiffColor = "auto"
+
+	dtabDiffCmd = &cobra.Command{
+		Use:   "diff [from] [to]",
+		Short: "Show the dentries that differ between two delegation tables",
+		Long: `Show the dentries that differ between two delegation tables.
+
+Each argument is a delegation table in namerd or a dtab file (- for stdin).
+Arguments may be written namerd:<name> or file:<path>; otherwise an
+argument naming an existing file is read as a file and anything else is
+fetched from namerd.
+
+Dentries are compared whole, so formatting and comments do not matter.
+Removed dentries are shown with '-', added ones with '+', and dentries
+whose destination changed as a '-' and '+' pair. Dentries that are only
+reordered, which changes their precedence, are shown with '~' at their
+new position. Unchanged dentries around the changes are shown for
+context.
+
+namerctl exits with status 1 when the tables differ.`,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch len(args) {
+			case 2:
+				color := false
+				switch dtabDiffColor {
+				case "always":
+					color = true
+				case "never":
+				case "auto":
+					color = isTerminal(os.Stdout)
+				default:
+					return fmt.Errorf("invalid --color: %s", dtabDiffColor)
+				}
+
+				src := &dtabSources{}
+				from, fromDtab, err := src.load(args[0])
+				if err != nil {
+					return err
+				}
+				to, toDtab, err := src.load(args[1])
+				if err != nil {
+					return err
+				}
+				changes := namer.DiffDtabs(fromDtab, toDtab)
+
+				if dtabJson {
+					result := dtabDiffResult{From: from, To: to, Changes: []*namer.DtabChange{}}
+					for _, c := range changes {
+						if c.Type != namer.ChangeUnchanged {
+							result.Changes = append(result.Changes, c)
+						}
+					}
+					bytes, err := json.Marshal(result)
+					if err != nil {
+						return err
+					}
+					fmt.Println(string(bytes))
+				} else {
+					printDtabDiff(os.Stdout, from, to, changes, color)
+				}
+
+				if namer.HasChanges(changes) {
+					return exitStatus(1)
+				}
+				return nil
+
+			default:
+				return errors.New("diff requires two delegation table names or files")
+			}
+		},
+	}
+)
+
+func init() {
+	dtabDiffCmd.PersistentFlags().StringVar(&dtabDiffColor, "color", "auto",
+		"color the diff: auto, always or never")
+	dtabCmd.AddCommand(dtabDiffCmd)
+}
+
+// dtabSources loads the arguments of dtab diff, connecting to namerd
+// only if one of them is a namerd dtab.
+type dtabSources struct {
+	ctl namer.Controller
+}
+
+// load returns a label for arg along with its dtab.
+func (s *dtabSources) load(arg string) (string, namer.Dtab, error) {
+	switch {
+	case strings.HasPrefix(arg, "namerd:"):
+		return s.loadNamerd(strings.TrimPrefix(arg, "namerd:"))
+	case strings.HasPrefix(arg, "file:"):
+		return loadDtabFile(strings.TrimPrefix(arg, "file:"))
+	case arg == "-":
+		return loadDtabFile(arg)
+	}
+	if _, err := os.Stat(arg); err == nil {
+		return loadDtabFile(arg)
+	}
+	return s.loadNamerd(arg)
+}
+
+func (s *dtabSources) loadNamerd(name string) (string, namer.Dtab, error) {
+	if s.ctl == nil {
+		ctl, err := getController()
+		if err != nil {
+			return "", nil, err
+		}
+		s.ctl = ctl
+	}
+	vd, err := namer.GetContext(cmdContext, s.ctl, name)
+	if err != nil {
+		return "", nil, annotate(err, "%s: %s", name, err)
+	}
+	return fmt.Sprintf("namerd:%s (version %s)", name, vd.Version), vd.Dtab, nil
+}
+
+func loadDtabFile(path string) (string, namer.Dtab, error) {
+	dtabstr, err := readDtabPath(path)
+	if err != nil {
+		return "", nil, err
+	}
+	dtab, err := validateDtab(path, dtabstr)
+	if err != nil {
+		return "", nil, err
+	}
+	return dtabFilename(path), dtab, nil
+}
+
+// printDtabDiff writes changes in the unified style of diff(1), with
+// diffContext unchanged dentries around each group of changes.
+func printDtabDiff(out io.Writer, from, to string, changes []*namer.DtabChange, color bool) {
+	if !namer.HasChanges(changes) {
+		return
+	}
+	paint := func(c, s string) string {
+		if !color {
+			return s
+		}
+		return c + s + colorReset
+	}
+
+	fmt.Fprintln(out, paint(colorBold, "--- "+from))
+	fmt.Fprintln(out, paint(colorBold, "+++ "+to))
+
+	// Show unchanged dentries within diffContext of a change.
+	show := make([]bool, len(changes))
+	for i, c := range changes {
+		if c.Type == namer.ChangeUnchanged {
+			continue
+		}
+		for j := i - diffContext; j <= i+diffContext; j++ {
+			if j >= 0 && j < len(changes) {
+				show[j] = true
+			}
+		}
+	}
+
+	for i, c := range changes {
+		if !show[i] {
+			continue
+		}
+		if i > 0 && !show[i-1] {
+			fmt.Fprintln(out, paint(colorCyan, "..."))
+		}
+		switch c.Type {
+		case namer.ChangeUnchanged:
+			fmt.Fprintf(out, "  %s\n", showDentry(c.New))
+		case namer.ChangeAdded:
+			fmt.Fprintln(out, paint(colorGreen, "+ "+showDentry(c.New)))
+		case namer.ChangeRemoved:
+			fmt.Fprintln(out, paint(colorRed, "- "+showDentry(c.Old)))
+		case namer.ChangeModified:
+			fmt.Fprintln(out, paint(colorRed, "- "+showDentry(c.Old)))
+			fmt.Fprintln(out, paint(colorGreen, "+ "+showDentry(c.New)))
+		case namer.ChangeMoved:
+			fmt.Fprintln(out, paint(colorYellow, fmt.Sprintf("~ %s  # moved from dentry %d to %d",
+				showDentry(c.New), c.OldIndex+1, c.NewIndex+1)))
+		}
+	}
+}
+
+func showDentry(d *namer.Dentry) string {
+	return fmt.Sprintf("%s => %s ;", d.Prefix, d.Destination)
+}
+
+// isTerminal reports whether f is a character device such as a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/linkerd/namerctl/namer"
+	"github.com/spf13/cobra"
+)
+
+const (
+	editHeader = `# Edit the delegation table below and save the file to update it in
+# namerd. Lines beginning with '#' are ignored, and an empty delegation
+# table aborts the edit.
+#
+# dtab: %s
+# version: %s
+
+`
+
+	// editErrorPrefix starts the comments that report errors in the
+	// edited file. They are removed when the file is reopened.
+	editErrorPrefix = "# error: "
+
+	conflictStart  = "# <<<<<<< your edits"
+	conflictMiddle = "# ======="
+	conflictEnd    = "# >>>>>>> namerd version "
+)
+
+var dtabEditCmd = &cobra.Command{
+	Use:   "edit [name]",
+	Short: "Edit a delegation table in $EDITOR",
+	Long: `Edit a delegation table in $EDITOR.
+
+The delegation table is fetched from namerd and opened in $VISUAL or
+$EDITOR (vi by default). When the file is saved and the editor exits,
+the dtab is checked and, if it is invalid, reopened with the errors as
+comments below the offending lines. The changes are then shown as a diff
+and namerd is updated only if the table has not been modified since it
+was fetched.
+
+If it has, namerctl offers to merge your edits into namerd's current
+version and reopens the editor with the result, marking dentries that
+both sides changed as conflicts to be resolved.`,
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		args = withDefaultNamespace(args, 1)
+		switch len(args) {
+		case 1:
+			ctl, err := getController()
+			if err != nil {
+				return err
+			}
+			vd, err := namer.GetContext(cmdContext, ctl, args[0])
+			if err != nil {
+				return err
+			}
+
+			tmp, err := ioutil.TempFile("", "namerctl-edit-")
+			if err != nil {
+				return err
+			}
+			tmp.Close()
+			session := &dtabEditSession{ctl: ctl, name: args[0], file: tmp.Name()}
+			err = session.run(vd)
+			if err == nil {
+				os.Remove(session.file)
+			}
+			return err
+
+		default:
+			return errors.New("edit requires a name")
+		}
+	},
+}
+
+func init() {
+	dtabCmd.AddCommand(dtabEditCmd)
+}
+
+// dtabEditSession edits one namerd dtab in a temporary file.
+type dtabEditSession struct {
+	ctl  namer.Controller
+	name string
+	file string
+}
+
+// run edits base until namerd accepts the result or the edit is aborted.
+func (s *dtabEditSession) run(base *namer.VersionedDtab) error {
+	text := s.header(base.Version) + (&namer.File{Dtab: base.Dtab}).Format()
+	for {
+		dtab, err := s.edit(text)
+		if err != nil {
+			return err
+		}
+		if dtab == nil || !namer.HasChanges(namer.DiffDtabs(base.Dtab, dtab)) {
+			fmt.Println("Edit cancelled, no changes made.")
+			return nil
+		}
+
+		printDtabDiff(os.Stdout, fmt.Sprintf("namerd:%s (version %s)", s.name, base.Version),
+			"edited", namer.DiffDtabs(base.Dtab, dtab), isTerminal(os.Stdout))
+		_, err = namer.UpdateContext(cmdContext, s.ctl, s.name, dtab.String(), base.Version)
+		switch err {
+		case nil:
+			fmt.Printf("Updated %s\n", s.name)
+			return nil
+
+		case namer.ErrVersionConflict:
+			latest, err := namer.GetContext(cmdContext, s.ctl, s.name)
+			if err != nil {
+				return s.preserve(err)
+			}
+			fmt.Printf("%s was modified in namerd since it was fetched (now version %s).\n",
+				s.name, latest.Version)
+			if !confirm("Merge your edits into the current version?") {
+				return s.preserve(namer.ErrVersionConflict)
+			}
+			text = s.header(latest.Version) +
+				mergeText(namer.MergeDtabs(base.Dtab, dtab, latest.Dtab), latest.Version)
+			base = latest
+
+		default:
+			return s.preserve(err)
+		}
+	}
+}
+
+// edit opens text in the editor until it is saved as a valid dtab. It
+// returns a nil Dtab when the edit is aborted.
+func (s *dtabEditSession) edit(text string) (namer.Dtab, error) {
+	for {
+		if err := ioutil.WriteFile(s.file, []byte(text), 0600); err != nil {
+			return nil, err
+		}
+		if err := runEditor(s.file); err != nil {
+			return nil, s.preserve(err)
+		}
+		bytes, err := ioutil.ReadFile(s.file)
+		if err != nil {
+			return nil, err
+		}
+		saved := string(bytes)
+		edited := stripEditErrors(saved)
+
+		dtab, problems := checkEditedDtab(s.name, edited)
+		if len(problems) == 0 {
+			if len(dtab) == 0 {
+				return nil, nil
+			}
+			return dtab, nil
+		}
+		if saved == text {
+			return nil, s.preserve(errors.New("the edited dtab is still invalid"))
+		}
+		text = annotateEditErrors(edited, problems)
+	}
+}
+
+func (s *dtabEditSession) header(version namer.Version) string {
+	return fmt.Sprintf(editHeader, s.name, version)
+}
+
+// preserve keeps the edited file so that the changes are not lost and
+// adds its location to err.
+func (s *dtabEditSession) preserve(err error) error {
+	return annotate(err, "%s\nyour changes have been saved to %s", err, s.file)
+}
+
+// checkEditedDtab parses an edited dtab. Problems are reported by line
+// number, starting at 1, with messages that include the column.
+func checkEditedDtab(name, text string) (namer.Dtab, map[int][]string) {
+	problems := map[int][]string{}
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == conflictStart || line == conflictMiddle || strings.HasPrefix(line, conflictEnd) {
+			problems[i+1] = append(problems[i+1], "unresolved merge conflict")
+		}
+	}
+
+	dtab, err := namer.ParseDtabFile(name, text)
+	if errs, ok := err.(namer.ErrorList); ok {
+		for _, e := range errs {
+			problems[e.Pos.Line] = append(problems[e.Pos.Line],
+				fmt.Sprintf("column %d: %s", e.Pos.Column, e.Msg))
+		}
+	}
+	return dtab, problems
+}
+
+// annotateEditErrors adds a comment below each line of text that has
+// problems.
+func annotateEditErrors(text string, problems map[int][]string) string {
+	lines := strings.Split(text, "\n")
+	out := []string{}
+	for i, line := range lines {
+		out = append(out, line)
+		for _, msg := range problems[i+1] {
+			out = append(out, editErrorPrefix+msg)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+func stripEditErrors(text string) string {
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), editErrorPrefix) {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// mergeText renders merged hunks as a dtab file. Conflicts show both
+// sides between comment markers, so the file still parses and is only
+// rejected until the markers are removed.
+func mergeText(hunks []*namer.MergeHunk, version namer.Version) string {
+	text := ""
+	for _, h := range hunks {
+		if !h.Conflict {
+			text += (&namer.File{Dtab: h.Dtab}).Format()
+			continue
+		}
+		text += conflictStart + "\n"
+		text += (&namer.File{Dtab: h.Ours}).Format()
+		text += conflictMiddle + "\n"
+		text += (&namer.File{Dtab: h.Theirs}).Format()
+		text += conflictEnd + string(version) + "\n"
+	}
+	return text
+}
+
+// runEditor opens path in the user's editor and waits for it to exit.
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	args := strings.Fields(editor)
+	cmd := exec.Command(args[0], append(args[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := withoutInterrupts(cmd.Run); err != nil {
+		return fmt.Errorf("%s: %s", editor, err)
+	}
+	return nil
+}
+
+// confirm asks a yes or no question on stdin, defaulting to yes.
+func confirm(question string) bool {
+	fmt.Printf("%s [Y/n] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "", "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/linkerd/namerctl/namer"
+	"github.com/linkerd/namerctl/namer/namertest"
+)
+
+// editorScript stands in for $EDITOR. Each time it is run, it copies the
+// file it is given to opened<n> and replaces it with edit<n>, leaving it
+// as it is if edit<n> is empty and exiting with an error if there is no
+// edit<n>.
+const editorScript = `#!/bin/sh
+dir='%s'
+n=$(($(cat "$dir/count" 2>/dev/null || echo 0) + 1))
+echo $n >"$dir/count"
+cp "$1" "$dir/opened$n"
+[ -f "$dir/edit$n" ] || exit 1
+[ -s "$dir/edit$n" ] && cp "$dir/edit$n" "$1"
+exit 0
+`
+
+type edittest struct {
+	name string
+	dtab string
+	// edits are what the editor saves each time it is opened, the file
+	// as it was opened if an edit is empty. The editor fails once they
+	// run out.
+	edits []string
+	// opened are found in the file each time the editor is opened.
+	opened []string
+	// concurrent is written to namerd before the edit is saved, unless
+	// it is empty.
+	concurrent string
+	// answer is the input to the merge prompt.
+	answer string
+	stderr string
+	status int
+	after  string
+}
+
+var edittests = []edittest{
+	{
+		"saved", "/a=>/b", []string{"/a => /c;\n"},
+		[]string{"# version: 1\n"}, "", "",
+		"", 0, "/a=>/c;",
+	},
+	{
+		"editor failed", "/a=>/b", nil,
+		[]string{"# dtab: web\n"}, "", "",
+		"exit status 1\nyour changes have been saved to ", -1, "/a=>/b;",
+	},
+	{
+		"no changes", "/a=>/b", []string{""},
+		[]string{"# dtab: web\n"}, "", "",
+		"", 0, "/a=>/b;",
+	},
+	{
+		"reopened when invalid", "/a=>/b", []string{"/a => ;\n", "/a => /c;\n"},
+		[]string{"# dtab: web\n", "/a => ;\n" + editErrorPrefix + "column 7: "}, "", "",
+		"", 0, "/a=>/c;",
+	},
+	{
+		"conflict merged", "/a=>/b;/m=>/n;/x=>/y", []string{"/a => /c;\n/m => /n;\n/x => /y;\n", ""},
+		[]string{"# version: 1\n", "# version: 2\n"}, "/a=>/b;/m=>/n;/x=>/z", "y\n",
+		"", 0, "/a=>/c;/m=>/n;/x=>/z;",
+	},
+	{
+		"conflict not merged", "/a=>/b;/x=>/y", []string{"/a => /c;\n/x => /y;\n"},
+		[]string{"# version: 1\n"}, "/a=>/b;/x=>/z", "n\n",
+		namer.ErrVersionConflict.Error(), exitVersionConflict, "/a=>/b;/x=>/z;",
+	},
+}
+
+// concurrentController writes concurrent to the dtab it is asked to
+// update first, as someone else could while it is edited.
+type concurrentController struct {
+	*namertest.Controller
+	concurrent string
+}
+
+func (c *concurrentController) UpdateContext(ctx context.Context, name, dtabstr string, version namer.Version) (namer.Version, error) {
+	if c.concurrent != "" {
+		if _, err := c.Controller.UpdateContext(ctx, name, c.concurrent, ""); err != nil {
+			return "", err
+		}
+		c.concurrent = ""
+	}
+	return c.Controller.UpdateContext(ctx, name, dtabstr, version)
+}
+
+func TestDtabEdit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake editor is a shell script")
+	}
+	defer func(visual, tmpdir string) {
+		os.Setenv("VISUAL", visual)
+		os.Setenv("TMPDIR", tmpdir)
+	}(os.Getenv("VISUAL"), os.Getenv("TMPDIR"))
+	defer func(stdin *os.File) { os.Stdin = stdin }(os.Stdin)
+
+	for _, test := range edittests {
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+		write := func(name, contents string) string {
+			path := filepath.Join(dir, name)
+			if err := ioutil.WriteFile(path, []byte(contents), 0755); err != nil {
+				t.Fatal(err)
+			}
+			return path
+		}
+		os.Setenv("VISUAL", write("editor", fmt.Sprintf(editorScript, dir)))
+		// The edited file is kept there when the edit fails.
+		os.Setenv("TMPDIR", dir)
+		for i, edit := range test.edits {
+			write(fmt.Sprintf("edit%d", i+1), edit)
+		}
+		stdin, err := os.Open(write("stdin", test.answer))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stdin.Close()
+		os.Stdin = stdin
+
+		ctl := newTestController(t, map[string]string{"web": test.dtab})
+		server := httptest.NewServer(namertest.NewHandler(&concurrentController{ctl, test.concurrent}))
+		config := write(".namerctl.yaml", "base-url: "+server.URL+"\n")
+		_, stderr, status := runNamerctl(t, config, "dtab", "edit", "web")
+		server.Close()
+
+		if !strings.Contains(stderr, test.stderr) || (test.stderr == "") != (stderr == "") {
+			t.Errorf("%s: expected errors containing '%s', got '%s'", test.name, test.stderr, stderr)
+		}
+		if status != test.status {
+			t.Errorf("%s: expected exit status %d, got %d", test.name, test.status, status)
+		}
+		for i, expected := range test.opened {
+			opened, err := ioutil.ReadFile(filepath.Join(dir, fmt.Sprintf("opened%d", i+1)))
+			if err != nil {
+				t.Errorf("%s: expected the editor to be opened %d times", test.name, len(test.opened))
+				break
+			}
+			if !strings.Contains(string(opened), expected) {
+				t.Errorf("%s: expected opening %d to contain '%s', got:\n%s", test.name, i+1, expected, opened)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, fmt.Sprintf("opened%d", len(test.opened)+1))); err == nil {
+			t.Errorf("%s: expected the editor to be opened %d times", test.name, len(test.opened))
+		}
+		expectDtabs(t, test.name, ctl, map[string]string{"web": test.after})
+	}
+}
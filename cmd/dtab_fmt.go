@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/linkerd/namerctl/namer"
+	"github.com/spf13/cobra"
+)
+
+var (
+	dtabFmtWrite = false
+	dtabFmtDiff  = false
+	dtabFmtCheck = false
+
+	dtabFmtCmd = &cobra.Command{
+		Use:   "fmt [file...]",
+		Short: "Format dtab files canonically",
+		Long: `Format dtab files canonically.
+
+Dentries are written one per line and terminated by " ;", with arrows
+aligned within each group of lines that is not separated by a blank line.
+Destinations longer than the line width have their alternates and
+unions wrapped onto separate lines. Comments are preserved.
+
+By default the formatted dtabs are printed. With no files, or -, the
+dtab is read from stdin.`,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				args = []string{"-"}
+			}
+			if dtabFmtWrite && (dtabFmtDiff || dtabFmtCheck) {
+				return errors.New("-w cannot be combined with -d or --check")
+			}
+
+			unformatted := false
+			for _, path := range args {
+				changed, err := formatDtabPath(path)
+				if err != nil {
+					return err
+				}
+				unformatted = unformatted || changed
+			}
+			if dtabFmtCheck && unformatted {
+				return exitStatus(1)
+			}
+			return nil
+		},
+	}
+)
+
+func init() {
+	dtabFmtCmd.PersistentFlags().BoolVarP(&dtabFmtWrite, "write", "w", false,
+		"write the result to the file instead of stdout")
+	dtabFmtCmd.PersistentFlags().BoolVarP(&dtabFmtDiff, "diff", "d", false,
+		"display diffs instead of formatted dtabs")
+	dtabFmtCmd.PersistentFlags().BoolVar(&dtabFmtCheck, "check", false,
+		"list files that are not formatted and exit with status 1 if there are any")
+	dtabCmd.AddCommand(dtabFmtCmd)
+}
+
+// formatDtabPath formats one file according to the fmt flags and reports
+// whether it was not already formatted.
+func formatDtabPath(path string) (bool, error) {
+	src, err := readDtabPath(path)
+	if err != nil {
+		return false, err
+	}
+	if isJSONDtab(src) {
+		return false, fmt.Errorf("%s: only text dtabs can be formatted", dtabFilename(path))
+	}
+	if _, err := validateDtab(path, src); err != nil {
+		return false, err
+	}
+	formatted, err := namer.Format(dtabFilename(path), []byte(src))
+	if err != nil {
+		return false, err
+	}
+	changed := string(formatted) != src
+
+	switch {
+	case dtabFmtWrite:
+		if path == "-" {
+			fmt.Print(string(formatted))
+		} else if changed {
+			info, err := os.Stat(path)
+			if err != nil {
+				return false, err
+			}
+			if err := ioutil.WriteFile(path, formatted, info.Mode()); err != nil {
+				return false, err
+			}
+		}
+	case dtabFmtDiff || dtabFmtCheck:
+		if changed && dtabFmtCheck {
+			fmt.Println(dtabFilename(path))
+		}
+		if changed && dtabFmtDiff {
+			name := dtabFilename(path)
+			fmt.Print(unifiedDiff(name+".orig", name, src, string(formatted)))
+		}
+	default:
+		fmt.Print(string(formatted))
+	}
+	return changed, nil
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/linkerd/namerctl/namer"
+	"github.com/spf13/cobra"
+)
+
+type lintResult struct {
+	// Source is the file or namerd dtab the problem was found in.
+	Source string `json:"source"`
+	*namer.LintProblem
+}
+
+var (
+	dtabLintRemote = false
+	dtabLintNamers = namer.DefaultNamers
+	dtabLintFailOn = namer.SeverityWarning
+
+	dtabLintCmd = &cobra.Command{
+		Use:   "lint [file...]",
+		Short: "Check delegation tables for mistakes",
+		Long: `Check delegation tables for mistakes.
+
+Each dentry is checked for duplicates, dentries shadowed by later ones,
+destinations that can never resolve (such as rewrite loops), unknown /#/
+namers, zero-weight union branches and prefixes with trailing slashes.
+Destinations whose delegation grows too large to follow are reported
+instead of being checked.
+
+Arguments are dtab files (or - for stdin). With --remote, they are instead
+names of delegation tables in namerd, and every table is checked when no
+names are given.
+
+namerctl exits with status 1 when a problem at or above the --fail-on
+severity is found.`,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var failSeverities []string
+			switch dtabLintFailOn {
+			case namer.SeverityWarning:
+				failSeverities = []string{namer.SeverityError, namer.SeverityWarning}
+			case namer.SeverityError:
+				failSeverities = []string{namer.SeverityError}
+			case "none":
+			default:
+				return fmt.Errorf("invalid --fail-on severity: %s", dtabLintFailOn)
+			}
+
+			var results []lintResult
+			var err error
+			if dtabLintRemote {
+				results, err = lintRemote(args)
+			} else {
+				results, err = lintFiles(args)
+			}
+			if err != nil {
+				return err
+			}
+
+			if dtabJson {
+				if results == nil {
+					results = []lintResult{}
+				}
+				bytes, err := json.Marshal(results)
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(bytes))
+			} else {
+				for _, result := range results {
+					where := result.Source
+					if result.Pos.IsValid() {
+						where = result.Pos.String()
+					} else if result.Dentry != nil {
+						where = fmt.Sprintf("%s: dentry %d", result.Source, result.Index)
+					}
+					fmt.Printf("%s: %s\n", where, result.LintProblem)
+				}
+			}
+
+			for _, result := range results {
+				for _, severity := range failSeverities {
+					if result.Severity == severity {
+						return exitStatus(1)
+					}
+				}
+			}
+			return nil
+		},
+	}
+)
+
+func init() {
+	dtabLintCmd.PersistentFlags().BoolVar(&dtabLintRemote, "remote", false,
+		"lint delegation tables in namerd instead of files")
+	dtabLintCmd.PersistentFlags().StringSliceVar(&dtabLintNamers, "namers", namer.DefaultNamers,
+		"namer prefixes configured in namerd, relative to /#/")
+	dtabLintCmd.PersistentFlags().StringVar(&dtabLintFailOn, "fail-on", namer.SeverityWarning,
+		"lowest severity that fails the lint: error, warning or none")
+	dtabCmd.AddCommand(dtabLintCmd)
+}
+
+func lintFiles(paths []string) ([]lintResult, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("lint requires at least one file")
+	}
+	results := []lintResult{}
+	for _, path := range paths {
+		dtabstr, err := readDtabPath(path)
+		if err != nil {
+			return nil, err
+		}
+		source := dtabFilename(path)
+
+		var dtab namer.Dtab
+		if isJSONDtab(dtabstr) {
+			dtab, err = decodeJSONDtab(path, dtabstr)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			dtab, err = namer.ParseDtabFile(source, dtabstr)
+			if errs, ok := err.(namer.ErrorList); ok {
+				for _, e := range errs {
+					results = append(results, lintResult{source, &namer.LintProblem{
+						Check:    "syntax",
+						Severity: namer.SeverityError,
+						Index:    -1,
+						Pos:      e.Pos,
+						Message:  e.Msg,
+					}})
+				}
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		results = append(results, lint(source, dtab)...)
+	}
+	return results, nil
+}
+
+func lintRemote(names []string) ([]lintResult, error) {
+	ctl, err := getController()
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		names, err = namer.ListContext(cmdContext, ctl)
+		if err != nil {
+			return nil, err
+		}
+	}
+	results := []lintResult{}
+	for _, name := range names {
+		vd, err := namer.GetContext(cmdContext, ctl, name)
+		if err != nil {
+			return nil, annotate(err, "%s: %s", name, err)
+		}
+		results = append(results, lint(name, vd.Dtab)...)
+	}
+	return results, nil
+}
+
+func lint(source string, dtab namer.Dtab) []lintResult {
+	results := []lintResult{}
+	for _, problem := range namer.Lint(dtab, namer.LintOptions{Namers: dtabLintNamers}) {
+		results = append(results, lintResult{source, problem})
+	}
+	return results
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/linkerd/namerctl/namer"
+	"github.com/spf13/cobra"
+)
+
+var (
+	dtabWatchDiff = false
+
+	dtabWatchCmd = &cobra.Command{
+		Use:   "watch [name]",
+		Short: "Print a delegation table each time it changes",
+		Long: `Print a delegation table each time it changes.
+
+The current version of the delegation table is printed first, followed by
+each new version as namerd reports it, until namerctl is interrupted.
+The watch is reopened if the connection to namerd is lost.
+
+With --diff, each new version is shown as a diff against the previous
+one. With --json, each version is printed as a JSON object on its own
+line.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			args = withDefaultNamespace(args, 1)
+			switch len(args) {
+			case 1:
+				ctl, err := getController()
+				if err != nil {
+					return err
+				}
+				watcher, ok := ctl.(namer.Watcher)
+				if !ok {
+					return &namer.ErrUnsupported{Operation: "watching dtabs"}
+				}
+				name := args[0]
+				updates, err := watcher.Watch(cmdContext, name)
+				if err != nil {
+					return err
+				}
+
+				var last *namer.VersionedDtab
+				for vd := range updates {
+					if err := printDtabUpdate(name, last, vd); err != nil {
+						return err
+					}
+					last = vd
+				}
+				if cmdContext.Err() != nil {
+					return nil
+				}
+
+				// The watch ended on its own; find out why.
+				if _, err := namer.GetContext(cmdContext, ctl, name); err != nil {
+					return err
+				}
+				return fmt.Errorf("watch of %s ended", name)
+
+			default:
+				return errors.New("watch requires a name")
+			}
+		},
+	}
+)
+
+func init() {
+	dtabWatchCmd.PersistentFlags().BoolVar(&dtabWatchDiff, "diff", false,
+		"show each version as a diff against the previous one")
+	dtabCmd.AddCommand(dtabWatchCmd)
+}
+
+func printDtabUpdate(name string, last, vd *namer.VersionedDtab) error {
+	if dtabJson {
+		bytes, err := json.Marshal(vd)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(bytes))
+		return nil
+	}
+
+	label := fmt.Sprintf("namerd:%s", name)
+	if vd.Version != "" {
+		label += fmt.Sprintf(" (version %s)", vd.Version)
+	}
+	if dtabWatchDiff && last != nil {
+		lastLabel := fmt.Sprintf("namerd:%s", name)
+		if last.Version != "" {
+			lastLabel += fmt.Sprintf(" (version %s)", last.Version)
+		}
+		printDtabDiff(os.Stdout, lastLabel, label, namer.DiffDtabs(last.Dtab, vd.Dtab), isTerminal(os.Stdout))
+		return nil
+	}
+
+	if last != nil {
+		fmt.Println()
+	}
+	fmt.Printf("# %s at %s\n", label, time.Now().Format(time.RFC3339))
+	fmt.Print(vd.Dtab.Pretty())
+	return nil
+}
@@ -0,0 +1,332 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/linkerd/namerctl/namer"
+	"github.com/spf13/cobra"
+)
+
+var (
+	dtabContexts    []string
+	dtabAllContexts = false
+	dtabAtomic      = false
+)
+
+type (
+	// target is a namerd that a dtab command runs against.
+	target struct {
+		Context string
+		ctl     namer.Controller
+	}
+
+	// targetResult is the outcome of a command on one target.
+	targetResult struct {
+		Context string               `json:"context"`
+		Result  string               `json:"result,omitempty"`
+		Error   string               `json:"error,omitempty"`
+		Dtab    *namer.VersionedDtab `json:"dtab,omitempty"`
+		Plan    []*applyStep         `json:"plan,omitempty"`
+
+		err  error
+		undo func() error
+	}
+
+	// targetOp runs a command on one target and records what it did in
+	// result. If it changed anything, it sets result.undo to a function
+	// that undoes the change, even when it then fails.
+	targetOp func(t *target, result *targetResult) error
+)
+
+// rollbackTimeout bounds the rollback of a change. Rollbacks run on a
+// context of their own, as cmdContext is already cancelled when they
+// follow an interrupt.
+const rollbackTimeout = 30 * time.Second
+
+// errNoVersion reports an update that cannot be rolled back safely.
+var errNoVersion = errors.New("namerd returned no version for the update; rolling back could overwrite a later change")
+
+// rollbackContext returns the context to roll back a change with.
+func rollbackContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), rollbackTimeout)
+}
+
+// addTargetFlags adds the flags that run cmd against several contexts,
+// and --atomic if cmd changes namerd.
+func addTargetFlags(cmd *cobra.Command, changes bool) {
+	cmd.PersistentFlags().StringSliceVar(&dtabContexts, "contexts", nil,
+		"run against each of these comma-separated contexts")
+	cmd.PersistentFlags().BoolVar(&dtabAllContexts, "all-contexts", false,
+		"run against every context in the configuration file")
+	if changes {
+		cmd.PersistentFlags().BoolVar(&dtabAtomic, "atomic", false,
+			"roll back the changes made if any context fails")
+	}
+}
+
+// getTargets returns the targets given by --contexts or --all-contexts,
+// or nil if neither is set.
+func getTargets() ([]*target, error) {
+	names := dtabContexts
+	if dtabAllContexts {
+		if len(names) > 0 {
+			return nil, errors.New("--contexts and --all-contexts cannot both be set")
+		}
+		_, config, err := readConfigFile()
+		if err != nil {
+			return nil, err
+		}
+		contexts, err := configContexts(config)
+		if err != nil {
+			return nil, err
+		}
+		for name := range contexts {
+			names = append(names, name)
+		}
+		if len(names) == 0 {
+			return nil, errors.New("--all-contexts: no contexts are configured")
+		}
+		sort.Strings(names)
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	if contextName != "" {
+		return nil, errors.New("--context cannot be combined with --contexts or --all-contexts")
+	}
+
+	targets := make([]*target, len(names))
+	seen := map[string]bool{}
+	for i, name := range names {
+		if seen[name] {
+			return nil, fmt.Errorf("context %s is given twice", name)
+		}
+		seen[name] = true
+		settings, err := loadSettings(name)
+		if err != nil {
+			return nil, err
+		}
+		ctl, err := newController(settings)
+		if err != nil {
+			return nil, annotate(err, "context %s: %s", name, err)
+		}
+		targets[i] = &target{Context: name, ctl: ctl}
+	}
+	return targets, nil
+}
+
+// runTargets runs op on every target concurrently. With --atomic, if op
+// fails on any target, the changes it made on every target are undone.
+func runTargets(targets []*target, op targetOp) []*targetResult {
+	results := make([]*targetResult, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t *target) {
+			defer wg.Done()
+			result := &targetResult{Context: t.Context}
+			if err := op(t, result); err != nil {
+				result.Error = err.Error()
+				result.err = err
+			}
+			results[i] = result
+		}(i, t)
+	}
+	wg.Wait()
+
+	if !dtabAtomic || failedTargets(results) == 0 {
+		return results
+	}
+	for _, result := range results {
+		if result.undo == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(result *targetResult) {
+			defer wg.Done()
+			err := result.undo()
+			switch {
+			case err != nil && result.err != nil:
+				result.Error = fmt.Sprintf("%s; rollback failed: %s", result.Error, err)
+			case err != nil:
+				result.Error = fmt.Sprintf("rollback failed: %s", err)
+				result.err = err
+			case result.Result != "":
+				result.Result += "; rolled back"
+			default:
+				result.Result = "rolled back"
+			}
+		}(result)
+	}
+	wg.Wait()
+	return results
+}
+
+// targetsError returns an error if any target failed. The first failure
+// decides the exit status.
+func targetsError(results []*targetResult) error {
+	failed := failedTargets(results)
+	for _, result := range results {
+		if result.err != nil {
+			return annotate(result.err, "failed on %d of %d contexts", failed, len(results))
+		}
+	}
+	return nil
+}
+
+// failedTargets counts the targets that failed.
+func failedTargets(results []*targetResult) int {
+	failed := 0
+	for _, result := range results {
+		if result.err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+// reportTargets prints results as a table, or as JSON with --json, and
+// returns an error if the command failed on any target.
+func reportTargets(results []*targetResult) error {
+	if dtabJson {
+		bytes, err := json.Marshal(results)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(bytes))
+	} else {
+		table := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(table, "CONTEXT\tRESULT")
+		for _, result := range results {
+			switch {
+			case result.Error != "" && result.Result != "":
+				fmt.Fprintf(table, "%s\t%s; error: %s\n", result.Context, result.Result, result.Error)
+			case result.Error != "":
+				fmt.Fprintf(table, "%s\terror: %s\n", result.Context, result.Error)
+			default:
+				fmt.Fprintf(table, "%s\t%s\n", result.Context, result.Result)
+			}
+		}
+		table.Flush()
+	}
+
+	return targetsError(results)
+}
+
+// getOp gets the named dtab.
+func getOp(name string) targetOp {
+	return func(t *target, result *targetResult) error {
+		vd, err := namer.GetContext(cmdContext, t.ctl, name)
+		if err != nil {
+			return err
+		}
+		result.Dtab = vd
+		result.Result = describeVersion("found", vd.Version)
+		return nil
+	}
+}
+
+// createOp creates the named dtab; undoing deletes it.
+func createOp(name, dtabstr string) targetOp {
+	return func(t *target, result *targetResult) error {
+		version, err := namer.CreateContext(cmdContext, t.ctl, name, dtabstr)
+		if err != nil {
+			return err
+		}
+		result.Result = describeVersion("created", version)
+		result.undo = func() error {
+			ctx, cancel := rollbackContext()
+			defer cancel()
+			return namer.DeleteContext(ctx, t.ctl, name)
+		}
+		return nil
+	}
+}
+
+// updateOp updates the named dtab; undoing restores its previous
+// dentries, unless it was changed again since. Without the version of
+// the update to condition on, undoing fails instead, as it could
+// overwrite a later change.
+func updateOp(name, dtabstr string) targetOp {
+	return func(t *target, result *targetResult) error {
+		previous, err := namer.GetContext(cmdContext, t.ctl, name)
+		if err != nil {
+			return err
+		}
+		version, err := namer.UpdateContext(cmdContext, t.ctl, name, dtabstr, previous.Version)
+		if err != nil {
+			return err
+		}
+		result.Result = describeVersion("updated", version)
+		result.undo = func() error {
+			if version == "" {
+				return errNoVersion
+			}
+			ctx, cancel := rollbackContext()
+			defer cancel()
+			_, err := namer.UpdateContext(ctx, t.ctl, name, previous.Dtab.String(), version)
+			return err
+		}
+		return nil
+	}
+}
+
+// deleteOp deletes the named dtab; undoing creates it again.
+func deleteOp(name string) targetOp {
+	return func(t *target, result *targetResult) error {
+		previous, err := namer.GetContext(cmdContext, t.ctl, name)
+		if err != nil {
+			return err
+		}
+		if err := namer.DeleteContext(cmdContext, t.ctl, name); err != nil {
+			return err
+		}
+		result.Result = "deleted"
+		result.undo = func() error {
+			ctx, cancel := rollbackContext()
+			defer cancel()
+			_, err := namer.CreateContext(ctx, t.ctl, name, previous.Dtab.String())
+			return err
+		}
+		return nil
+	}
+}
+
+func describeVersion(action string, version namer.Version) string {
+	if version == "" {
+		return action
+	}
+	return fmt.Sprintf("%s (version %s)", action, version)
+}
+
+// printTargetDtabs prints the dtabs found by getOp on each target, under
+// the name of its context, and returns an error if any could not be got.
+func printTargetDtabs(results []*targetResult) error {
+	if dtabJson {
+		return reportTargets(results)
+	}
+	for _, result := range results {
+		switch {
+		case result.err != nil:
+			fmt.Printf("# context %s: error: %s\n", result.Context, result.Error)
+		case dtabGetPretty:
+			fmt.Printf("# context %s\n", result.Context)
+			if result.Dtab.Version != namer.Version("") {
+				fmt.Printf("# version %s\n", result.Dtab.Version)
+			}
+			fmt.Print(result.Dtab.Dtab.Pretty())
+		default:
+			fmt.Printf("# context %s\n", result.Context)
+			fmt.Println(result.Dtab.Dtab.String())
+		}
+	}
+	return targetsError(results)
+}
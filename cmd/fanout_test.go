@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/linkerd/namerctl/namer"
+	"github.com/linkerd/namerctl/namer/namertest"
+)
+
+type fanouttest struct {
+	name   string
+	atomic bool
+	op     targetOp
+	// before and after are the dtab web held by the contexts a, b and
+	// c, which have no dtab web if they are missing.
+	before map[string]string
+	// wrap, if set, wraps the controller of context a.
+	wrap    func(ctl *namertest.Controller) namer.Controller
+	results []string
+	after   map[string]string
+}
+
+var (
+	notFound = "error: " + namer.ErrNotFound.Error()
+
+	fanouttests = []fanouttest{
+		{
+			"update rollback", true, updateOp("web", "/x=>/2"),
+			map[string]string{"a": "/a=>/1", "b": "/b=>/1"}, nil,
+			// namerd gives every change a new version, the rollback too.
+			[]string{"updated (version 2); rolled back", "updated (version 2); rolled back", notFound},
+			map[string]string{"a": "/a=>/1;", "b": "/b=>/1;"},
+		},
+		{
+			"create rollback", true, createOp("web", "/x=>/2"),
+			map[string]string{"c": "/c=>/1"}, nil,
+			[]string{"created (version 1); rolled back", "created (version 1); rolled back",
+				"error: " + namer.ErrAlreadyExists.Error()},
+			map[string]string{"c": "/c=>/1;"},
+		},
+		{
+			"delete rollback", true, deleteOp("web"),
+			map[string]string{"a": "/a=>/1", "b": "/b=>/1"}, nil,
+			[]string{"deleted; rolled back", "deleted; rolled back", notFound},
+			map[string]string{"a": "/a=>/1;", "b": "/b=>/1;"},
+		},
+		{
+			"without atomic", false, updateOp("web", "/x=>/2"),
+			map[string]string{"a": "/a=>/1"}, nil,
+			[]string{"updated (version 2)", notFound, notFound},
+			map[string]string{"a": "/x=>/2;"},
+		},
+		{
+			"rollback conflict", true, updateOp("web", "/x=>/2"),
+			map[string]string{"a": "/a=>/1"},
+			func(ctl *namertest.Controller) namer.Controller { return &interferingController{Controller: ctl} },
+			[]string{"updated (version 2); error: rollback failed: " + namer.ErrVersionConflict.Error(), notFound, notFound},
+			// The change made since the update is kept.
+			map[string]string{"a": "/other=>/3;"},
+		},
+		{
+			"rollback without version", true, updateOp("web", "/x=>/2"),
+			map[string]string{"a": "/a=>/1"},
+			func(ctl *namertest.Controller) namer.Controller { return versionlessController{ctl} },
+			[]string{"updated; error: rollback failed: " + errNoVersion.Error(), notFound, notFound},
+			map[string]string{"a": "/x=>/2;"},
+		},
+	}
+)
+
+// interferingController changes the dtab web before it is rolled back,
+// as someone else could.
+type interferingController struct {
+	*namertest.Controller
+	updates int
+}
+
+func (c *interferingController) UpdateContext(ctx context.Context, name, dtabstr string, version namer.Version) (namer.Version, error) {
+	c.updates++
+	if c.updates == 2 {
+		if _, err := c.Controller.UpdateContext(ctx, name, "/other=>/3", ""); err != nil {
+			return "", err
+		}
+	}
+	return c.Controller.UpdateContext(ctx, name, dtabstr, version)
+}
+
+// versionlessController does not return the versions of updates, as
+// namerd behind a proxy that drops ETags does not.
+type versionlessController struct {
+	*namertest.Controller
+}
+
+func (c versionlessController) UpdateContext(ctx context.Context, name, dtabstr string, version namer.Version) (namer.Version, error) {
+	_, err := c.Controller.UpdateContext(ctx, name, dtabstr, version)
+	return "", err
+}
+
+func TestRunTargets(t *testing.T) {
+	defer func(atomic bool) { dtabAtomic = atomic }(dtabAtomic)
+	for _, test := range fanouttests {
+		targets := []*target{}
+		ctls := map[string]*namertest.Controller{}
+		for _, name := range []string{"a", "b", "c"} {
+			dtabs := map[string]string{}
+			if dtabstr, ok := test.before[name]; ok {
+				dtabs["web"] = dtabstr
+			}
+			ctls[name] = newTestController(t, dtabs)
+			target := &target{Context: name, ctl: ctls[name]}
+			if name == "a" && test.wrap != nil {
+				target.ctl = test.wrap(ctls[name])
+			}
+			targets = append(targets, target)
+		}
+
+		dtabAtomic = test.atomic
+		for i, result := range runTargets(targets, test.op) {
+			actual := result.Result
+			switch {
+			case result.Error != "" && actual != "":
+				actual += "; error: " + result.Error
+			case result.Error != "":
+				actual = "error: " + result.Error
+			}
+			if actual != test.results[i] {
+				t.Errorf("%s: context %s: expected '%s', got '%s'", test.name, result.Context, test.results[i], actual)
+			}
+		}
+		for name, ctl := range ctls {
+			after := map[string]string{}
+			if dtabstr, ok := test.after[name]; ok {
+				after["web"] = dtabstr
+			}
+			expectDtabs(t, test.name+": context "+name, ctl, after)
+		}
+	}
+}
+
+type interrupttest struct {
+	name   string
+	op     targetOp
+	before map[string]string
+	result string
+	after  map[string]string
+}
+
+var interrupttests = []interrupttest{
+	{"create", createOp("web", "/x=>/2"), map[string]string{}, "created (version 1); rolled back", map[string]string{}},
+	{"update", updateOp("web", "/x=>/2"), map[string]string{"web": "/a=>/1"}, "updated (version 2); rolled back",
+		map[string]string{"web": "/a=>/1;"}},
+	{"delete", deleteOp("web"), map[string]string{"web": "/a=>/1"}, "deleted; rolled back",
+		map[string]string{"web": "/a=>/1;"}},
+}
+
+// The changes made before namerctl is interrupted are rolled back, even
+// though the requests made for the command are cancelled.
+func TestRunTargetsInterrupted(t *testing.T) {
+	defer func(ctx context.Context, cancel context.CancelFunc, atomic bool) {
+		cmdContext, cancelCommand, dtabAtomic = ctx, cancel, atomic
+	}(cmdContext, cancelCommand, dtabAtomic)
+	dtabAtomic = true
+	for _, test := range interrupttests {
+		cmdContext, cancelCommand = context.WithCancel(context.Background())
+		op := test.op
+		interrupted := func(t *target, result *targetResult) error {
+			if err := op(t, result); err != nil {
+				return err
+			}
+			cancelCommand()
+			return cmdContext.Err()
+		}
+		ctl := newTestController(t, test.before)
+		results := runTargets([]*target{{Context: "a", ctl: ctl}}, interrupted)
+		if results[0].Result != test.result || results[0].err != context.Canceled {
+			t.Errorf("%s: expected '%s' and the interrupt, got '%s' and %v",
+				test.name, test.result, results[0].Result, results[0].err)
+		}
+		expectDtabs(t, test.name, ctl, test.after)
+	}
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/linkerd/namerctl/namer"
+	"github.com/spf13/cobra"
+)
+
+var (
+	resolveOverlay = ""
+	resolveWatch   = false
+
+	resolveCmd = &cobra.Command{
+		Use:   "resolve [namespace] [path]",
+		Short: "Show the addresses a path resolves to",
+		Long: `Show the addresses a path resolves to.
+
+namerd binds the path as 'namerctl bind' does and resolves the bound
+names to the replica set that requests for the path would be sent to.
+Each address is shown with its weight and the share of requests it
+receives.
+
+With --dtab, the given dentries are added to the namespace's delegation
+table for this request only, as a request's l5d-dtab header would be.
+
+With --watch, the addresses are printed once, and then each address
+added or removed afterwards is printed as ADDED or REMOVED, until
+namerctl is interrupted. With --json, each set of addresses is printed
+in full as a JSON object on its own line.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			args = withDefaultNamespace(args, 2)
+			switch len(args) {
+			case 2:
+				ctl, err := getController()
+				if err != nil {
+					return err
+				}
+				resolver, ok := ctl.(namer.Resolver)
+				if !ok {
+					return &namer.ErrUnsupported{Operation: "resolving names"}
+				}
+				ns := args[0]
+				path, err := namer.ParsePath(args[1])
+				if err != nil {
+					return fmt.Errorf("invalid path '%s': %s", args[1], err)
+				}
+				overlay, err := parseOverlay(resolveOverlay)
+				if err != nil {
+					return err
+				}
+
+				if !resolveWatch {
+					addr, err := resolver.Resolve(cmdContext, ns, path, overlay)
+					if err != nil {
+						return err
+					}
+					return printAddr(os.Stdout, addr, true)
+				}
+
+				addrs, err := resolver.WatchResolve(cmdContext, ns, path, overlay)
+				if err != nil {
+					return err
+				}
+				if err := printAddrUpdates(addrs, true, "addresses of %s in %s", path, ns); err != nil {
+					return err
+				}
+				if cmdContext.Err() != nil {
+					return nil
+				}
+
+				// The watch ended on its own; find out why.
+				if _, err := resolver.Resolve(cmdContext, ns, path, overlay); err != nil {
+					return err
+				}
+				return fmt.Errorf("watch of %s in %s ended", path, ns)
+
+			default:
+				return errors.New("resolve requires a namespace and a path")
+			}
+		},
+	}
+)
+
+func init() {
+	resolveCmd.PersistentFlags().StringVar(&resolveOverlay, "dtab", "",
+		"dentries to add to the namespace's dtab for this request")
+	resolveCmd.PersistentFlags().BoolVar(&resolveWatch, "watch", false,
+		"print addresses as they are added and removed")
+	resolveCmd.PersistentFlags().BoolVar(&jsonOutput, "json", false, "output in json instead of text")
+	RootCmd.AddCommand(resolveCmd)
+}
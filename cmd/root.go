@@ -1,26 +1,71 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/linkerd/namerctl/namer"
 	"github.com/spf13/cobra"
-	//jww "github.com/spf13/jwalterweatherman"
 	"github.com/spf13/viper"
 )
 
 var cfgFile string
 var baseURLString string
 
-func getBaseURL() (*url.URL, error) {
-	if baseURLString == "" {
-		baseURLString = viper.GetString("base-url")
+// verbosity is the number of times -v was given: once to trace every
+// request and response and report retries, and twice to trace their
+// headers and bodies too.
+var verbosity verbosityValue
+
+// verbosityValue counts the times its flag is given. It calls itself a
+// bool, as cobra takes the argument after any other flag for its value
+// when looking for the subcommand, and so would take 'dtab' in
+// 'namerctl -v dtab list'.
+type verbosityValue int
+
+func (v *verbosityValue) Set(s string) error {
+	switch s {
+	case "true":
+		*v++
+	case "false":
+		*v = 0
+	default:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		*v = verbosityValue(n)
 	}
+	return nil
+}
+
+func (v *verbosityValue) String() string { return strconv.Itoa(int(*v)) }
+func (v *verbosityValue) Type() string   { return "bool" }
+
+// settings holds the configuration of the context in use, as given by
+// flags, environment variables and the configuration file.
+var settings *viper.Viper
+
+// defaultTimeout bounds each request to namerd unless --timeout is set.
+const defaultTimeout = 30 * time.Second
+
+// cmdContext is passed to every request to namerd. It is cancelled when
+// namerctl is interrupted, abandoning the requests in flight.
+var cmdContext, cancelCommand = context.WithCancel(context.Background())
+
+func getBaseURL(settings *viper.Viper) (*url.URL, error) {
+	baseURLString := settings.GetString("base-url")
 	if baseURLString == "" {
 		return nil, errors.New("empty base URL")
 	}
@@ -34,13 +79,41 @@ func getBaseURL() (*url.URL, error) {
 	return u, nil
 }
 
+// getController returns a Controller for the namerd of the context in
+// use.
 func getController() (namer.Controller, error) {
-	baseURL, err := getBaseURL()
+	if contextErr != nil {
+		return nil, contextErr
+	}
+	return newController(settings)
+}
+
+// newController returns a Controller configured by settings.
+func newController(settings *viper.Viper) (namer.Controller, error) {
+	baseURL, err := getBaseURL(settings)
 	if err != nil {
 		return nil, err
 	}
-	ctl := namer.NewHttpController(baseURL, &http.Client{})
-	return ctl, nil
+	retry := namer.DefaultRetryPolicy
+	retry.MaxAttempts = settings.GetInt("retries") + 1
+	opts, err := getAuthOptions(settings)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, namer.WithRetryPolicy(retry))
+	if verbosity > 0 {
+		// Logged to stderr so that the output of commands can still be
+		// parsed.
+		logger := log.New(os.Stderr, "namerctl: ", 0)
+		opts = append(opts, namer.WithLogger(logger))
+		opts = append(opts, namer.WithTrace(logger, verbosity > 1))
+	}
+	transport, err := getTransport(settings)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Transport: transport, Timeout: settings.GetDuration("timeout")}
+	return namer.NewHttpController(baseURL, client, opts...), nil
 }
 
 // This represents the base command when called without any subcommands
@@ -52,30 +125,228 @@ var RootCmd = &cobra.Command{
 namerctl looks for a configuration file in the current working
 directory or any of its parent directories. Configuration files are
 named .namerctl.<ext> where <ext> is describes one of several formats
-including yaml, json, toml, etc.  "base-url" is currently the only
-supported configuration.  Furthermore, the base url may be specified
-via the NAMERCTL_BASE_URL environment variable.
+including yaml, json, toml, etc.  "base-url", "timeout" (such as
+"10s") and "retries" are the supported configurations, as well as
+"ca-file", "cert-file", "key-file", "server-name" and
+"insecure-skip-verify" for namerd served over TLS, and "token",
+"token-file", "token-command", "username", "password" and "header" (a
+list) for namerd behind an authenticating proxy.  Furthermore, they may
+be specified via environment variables such as NAMERCTL_BASE_URL,
+NAMERCTL_TIMEOUT and NAMERCTL_TOKEN.  Settings for several namerd clusters
+can be kept as named contexts; see 'namerctl config --help'.
+
+namerctl exits with status 3 when a delegation table is not found, 4 when
+it already exists, 5 when it was modified concurrently, 6 when namerd
+rejects a request as invalid and 7 for other namerd errors. Commands that
+compare or check dtabs exit with status 1 when they find differences or
+problems.
 
 Find more information at https://linkerd.io`,
+	// Execute reports errors itself, with hints that depend on the error.
+	SilenceErrors: true,
+	SilenceUsage:  true,
 }
 
 // Execute adds all child commands to the root command sets flags
 // appropriately.  This is called by main.main(). It only needs to
 // happen once to the rootCmd.
 func Execute() {
-	if err := RootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(-1)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for range signals {
+			interruptsMu.Lock()
+			ignore := ignoreInterrupts
+			interruptsMu.Unlock()
+			if !ignore {
+				// A second signal kills namerctl.
+				signal.Stop(signals)
+				cancelCommand()
+				return
+			}
+		}
+	}()
+
+	if status := run(); status != 0 {
+		os.Exit(status)
 	}
 }
 
+// run executes the command given on the command line, reports its error
+// if it fails, and returns the status namerctl exits with.
+func run() int {
+	cmd, err := RootCmd.ExecuteC()
+	if err == nil {
+		return 0
+	}
+	if status, ok := err.(exitStatus); ok {
+		return int(status)
+	}
+	// Errors go to stderr, so that they do not mix with the output of
+	// commands.
+	if cmdContext.Err() != nil {
+		if err == context.Canceled {
+			fmt.Fprintln(os.Stderr, "interrupted")
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return exitInterrupted
+	}
+	fmt.Fprintln(os.Stderr, err)
+	status, hint := describeError(cause(err))
+	if hint == "" && status == -1 {
+		hint = fmt.Sprintf("Run '%s --help' for usage.", cmd.CommandPath())
+	}
+	if hint != "" {
+		fmt.Fprintln(os.Stderr, hint)
+	}
+	return status
+}
+
+// Exit statuses for errors returned by namerd.
+const (
+	exitNotFound        = 3
+	exitAlreadyExists   = 4
+	exitVersionConflict = 5
+	exitBadRequest      = 6
+	exitAPIError        = 7
+
+	// exitInterrupted is the status of a shell command killed by SIGINT.
+	exitInterrupted = 130
+)
+
+// describeError returns the exit status for err and a hint on how to
+// recover from it, if there is one.
+func describeError(err error) (int, string) {
+	switch e := err.(type) {
+	case *url.Error:
+		if hint := describeTLSError(e.Err); hint != "" {
+			return -1, hint
+		}
+		if e.Timeout() {
+			return -1, "namerd did not respond in time; use --timeout to wait longer."
+		}
+		return -1, "Check that namerd is reachable at the --base-url."
+	case *namer.ErrBadRequest:
+		return exitBadRequest, "namerd rejected the request; check the dtab with `namerctl dtab lint`."
+	case *namer.APIError:
+		if e.StatusCode >= 500 {
+			return exitAPIError, "namerd failed to handle the request; check its logs."
+		}
+		return exitAPIError, ""
+	}
+	switch err {
+	case namer.ErrNotFound:
+		return exitNotFound, "List the existing delegation tables with `namerctl dtab list`."
+	case namer.ErrAlreadyExists:
+		return exitAlreadyExists, "Use `namerctl dtab update` to replace it."
+	case namer.ErrVersionConflict:
+		return exitVersionConflict, "Fetch the current version with `namerctl dtab get` and try again, " +
+			"or use `namerctl dtab edit` to merge your changes into it."
+	}
+	return -1, ""
+}
+
+// annotatedError replaces the message of an error while keeping the
+// error itself, so that Execute can still choose its exit status.
+type annotatedError struct {
+	msg string
+	err error
+}
+
+func (err *annotatedError) Error() string {
+	return err.msg
+}
+
+// annotate returns err with the message given by format and args.
+func annotate(err error, format string, args ...interface{}) error {
+	return &annotatedError{fmt.Sprintf(format, args...), err}
+}
+
+// cause returns the error that err annotates, if any.
+func cause(err error) error {
+	for {
+		annotated, ok := err.(*annotatedError)
+		if !ok {
+			return err
+		}
+		err = annotated.err
+	}
+}
+
+var (
+	interruptsMu     sync.Mutex
+	ignoreInterrupts bool
+)
+
+// withoutInterrupts runs f, which hands the terminal to another program,
+// without cancelling cmdContext when that program is sent Ctrl-C.
+func withoutInterrupts(f func() error) error {
+	interruptsMu.Lock()
+	ignoreInterrupts = true
+	interruptsMu.Unlock()
+	defer func() {
+		interruptsMu.Lock()
+		ignoreInterrupts = false
+		interruptsMu.Unlock()
+	}()
+	return f()
+}
+
+// exitStatus is returned by commands that have already reported their
+// outcome and only need namerctl to exit with a given status.
+type exitStatus int
+
+func (status exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(status))
+}
+
 func init() {
-	//jww.SetStdoutThreshold(jww.LevelTrace)
 	cobra.OnInitialize(initConfig)
 	RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file")
 	RootCmd.PersistentFlags().StringVar(&baseURLString, "base-url", "",
 		"namer location (e.g. http://namerd.example.com:4080)")
 	viper.BindPFlag("base-url", RootCmd.PersistentFlags().Lookup("base-url"))
+	RootCmd.PersistentFlags().Duration("timeout", defaultTimeout,
+		"time limit for each request to namerd; 0 means no limit")
+	viper.BindPFlag("timeout", RootCmd.PersistentFlags().Lookup("timeout"))
+	RootCmd.PersistentFlags().Int("retries", namer.DefaultRetryPolicy.MaxAttempts-1,
+		"times to retry requests that fail while namerd is unavailable")
+	viper.BindPFlag("retries", RootCmd.PersistentFlags().Lookup("retries"))
+	RootCmd.PersistentFlags().String("ca-file", "",
+		"PEM bundle of the CAs trusted to sign namerd's certificate")
+	viper.BindPFlag("ca-file", RootCmd.PersistentFlags().Lookup("ca-file"))
+	RootCmd.PersistentFlags().String("cert-file", "",
+		"PEM client certificate to present to namerd")
+	viper.BindPFlag("cert-file", RootCmd.PersistentFlags().Lookup("cert-file"))
+	RootCmd.PersistentFlags().String("key-file", "",
+		"PEM private key of the client certificate")
+	viper.BindPFlag("key-file", RootCmd.PersistentFlags().Lookup("key-file"))
+	RootCmd.PersistentFlags().String("server-name", "",
+		"name expected in namerd's certificate, if not the --base-url host")
+	viper.BindPFlag("server-name", RootCmd.PersistentFlags().Lookup("server-name"))
+	RootCmd.PersistentFlags().Bool("insecure-skip-verify", false,
+		"do not verify namerd's certificate (insecure)")
+	viper.BindPFlag("insecure-skip-verify", RootCmd.PersistentFlags().Lookup("insecure-skip-verify"))
+	RootCmd.PersistentFlags().String("token", "",
+		"bearer token to authenticate to namerd with")
+	viper.BindPFlag("token", RootCmd.PersistentFlags().Lookup("token"))
+	RootCmd.PersistentFlags().String("token-file", "",
+		"file to read the bearer token from before each request")
+	viper.BindPFlag("token-file", RootCmd.PersistentFlags().Lookup("token-file"))
+	RootCmd.PersistentFlags().String("token-command", "",
+		"credential helper command that prints the bearer token")
+	viper.BindPFlag("token-command", RootCmd.PersistentFlags().Lookup("token-command"))
+	RootCmd.PersistentFlags().String("username", "", "username for basic auth")
+	viper.BindPFlag("username", RootCmd.PersistentFlags().Lookup("username"))
+	RootCmd.PersistentFlags().String("password", "",
+		"password for basic auth; prefer NAMERCTL_PASSWORD or a config file")
+	viper.BindPFlag("password", RootCmd.PersistentFlags().Lookup("password"))
+	RootCmd.PersistentFlags().StringArrayVar(&headerFlags, "header", nil,
+		"header to add to every request, as 'Name: value' (repeatable)")
+	RootCmd.PersistentFlags().VarP(&verbosity, "verbose", "v",
+		"trace requests, responses and retries on stderr; -vv adds headers and bodies")
+	RootCmd.PersistentFlags().Lookup("verbose").NoOptDefVal = "true"
 }
 
 func addParentConfigPaths(dir string) {
@@ -89,9 +360,11 @@ func addParentConfigPaths(dir string) {
 func initConfig() {
 	if cfgFile != "" { // set on commandline
 		viper.SetConfigFile(cfgFile)
+	} else {
+		// SetConfigName would clear the file set by SetConfigFile.
+		viper.SetConfigName(".namerctl")
+		addParentConfigPaths(os.Getenv("PWD"))
 	}
-	viper.SetConfigName(".namerctl")
-	addParentConfigPaths(os.Getenv("PWD"))
 	viper.SetEnvPrefix("namerctl")
 	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 	viper.AutomaticEnv()
@@ -100,4 +373,10 @@ func initConfig() {
 	if err := viper.ReadInConfig(); err != nil && viper.ConfigFileUsed() != "" {
 		fmt.Fprintln(os.Stderr, err)
 	}
+
+	// Errors are reported by getController, so that commands that do not
+	// contact namerd, such as 'config use-context', still work.
+	if settings, contextErr = loadSettings(selectedContext()); contextErr != nil {
+		settings, _ = loadSettings("")
+	}
 }
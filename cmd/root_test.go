@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/linkerd/namerctl/namer"
+	"github.com/linkerd/namerctl/namer/namertest"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// newTestController returns an in-memory controller holding dtabs.
+func newTestController(t *testing.T, dtabs map[string]string) *namertest.Controller {
+	ctl := namertest.NewController()
+	for ns, dtabstr := range dtabs {
+		if _, err := ctl.Create(ns, dtabstr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ctl
+}
+
+// expectDtabs checks that ctl holds exactly the dtabs in expected.
+func expectDtabs(t *testing.T, what string, ctl namer.Controller, expected map[string]string) {
+	names, err := ctl.List()
+	if err != nil {
+		t.Fatalf("%s: %s", what, err)
+	}
+	if len(names) != len(expected) {
+		t.Errorf("%s: expected namespaces %q, got %q", what, expected, names)
+	}
+	for _, name := range names {
+		vd, err := ctl.Get(name)
+		if err != nil {
+			t.Errorf("%s: %s: %s", what, name, err)
+			continue
+		}
+		if vd.Dtab.String() != expected[name] {
+			t.Errorf("%s: %s: expected %s, got %s", what, name, expected[name], vd.Dtab)
+		}
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "namerctl-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// runNamerctl runs namerctl with args and the configuration file at
+// config, and returns what it printed on stdout and stderr and its exit
+// status.
+func runNamerctl(t *testing.T, config string, args ...string) (string, string, int) {
+	resetFlags(RootCmd)
+	// Setting a slice flag again appends to its variable, so that the
+	// variables are reset too.
+	headerFlags = nil
+	dtabLintNamers = append([]string(nil), namer.DefaultNamers...)
+	dtabContexts = nil
+
+	stdout := capture(t, &os.Stdout)
+	stderr := capture(t, &os.Stderr)
+	RootCmd.SetArgs(append([]string{"--config", config}, args...))
+	status := run()
+	return stdout(), stderr(), status
+}
+
+// capture redirects *file to a pipe, until the function it returns puts
+// *file back and returns what was written to it.
+func capture(t *testing.T, file **os.File) func() string {
+	saved := *file
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	*file = w
+	output := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		output <- buf.String()
+	}()
+	return func() string {
+		*file = saved
+		w.Close()
+		return <-output
+	}
+}
+
+// resetFlags sets the flags of cmd and its subcommands back to their
+// defaults, as if namerctl had just started.
+func resetFlags(cmd *cobra.Command) {
+	reset := func(flag *pflag.Flag) {
+		if !strings.HasSuffix(flag.Value.Type(), "Slice") && !strings.HasSuffix(flag.Value.Type(), "Array") {
+			flag.Value.Set(flag.DefValue)
+		}
+		flag.Changed = false
+	}
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	for _, sub := range cmd.Commands() {
+		resetFlags(sub)
+	}
+}
+
+// expectOutput checks the output and exit status of runNamerctl.
+func expectOutput(t *testing.T, what, stdout, stderr string, status int, expectedStdout, expectedStderr string, expectedStatus int) {
+	if stdout != expectedStdout {
+		t.Errorf("%s: expected output:\n%s\ngot:\n%s", what, expectedStdout, stdout)
+	}
+	if stderr != expectedStderr {
+		t.Errorf("%s: expected errors:\n%s\ngot:\n%s", what, expectedStderr, stderr)
+	}
+	if status != expectedStatus {
+		t.Errorf("%s: expected exit status %d, got %d", what, expectedStatus, status)
+	}
+}
+
+type verbosetest struct {
+	args      []string
+	verbosity verbosityValue
+}
+
+var verbosetests = []verbosetest{
+	{[]string{"dtab", "list"}, 0},
+	{[]string{"-v", "dtab", "list"}, 1},
+	{[]string{"dtab", "-v", "list"}, 1},
+	{[]string{"-vv", "dtab", "list"}, 2},
+	{[]string{"-v", "-v", "-v", "dtab", "list"}, 3},
+	{[]string{"--verbose", "dtab", "list"}, 1},
+	{[]string{"--verbose=2", "dtab", "list"}, 2},
+}
+
+func TestVerboseFlag(t *testing.T) {
+	server := httptest.NewServer(namertest.NewHandler(newTestController(t, map[string]string{"web": "/a=>/b"})))
+	defer server.Close()
+	config := writeConfig(t, ".namerctl.yaml", "base-url: "+server.URL+"\n")
+	defer os.RemoveAll(filepath.Dir(config))
+
+	for _, test := range verbosetests {
+		what := strings.Join(test.args, " ")
+		// The requests are traced on stderr.
+		stdout, _, status := runNamerctl(t, config, test.args...)
+		expectOutput(t, what, stdout, "", status, "web\n", "", 0)
+		if verbosity != test.verbosity {
+			t.Errorf("%s: expected verbosity %d, got %d", what, test.verbosity, verbosity)
+		}
+	}
+}
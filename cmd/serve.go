@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/linkerd/namerctl/namer"
+	"github.com/linkerd/namerctl/namer/namertest"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveListen = "127.0.0.1:4180"
+	serveDir    = ""
+	serveSeed   = false
+
+	serveCmd = &cobra.Command{
+		Use:   "serve",
+		Short: "Serve namerd's HTTP API from memory, for development and tests",
+		Long: `Serve namerd's HTTP API from memory, for development and tests.
+
+namerctl serve stands in for namerd where running the real one is not
+worth it. It serves the dtabs endpoints, with versions as ETags,
+conditional updates with If-Match and watches with watch=true. The bind,
+addr, resolve and delegate endpoints delegate offline, like 'namerctl
+dtab delegate --offline'; bound names have no addresses.
+
+Delegation tables are kept in memory and lost on exit, unless --dir is
+given: then the *.dtab and *.json files in that directory are served,
+as 'namerctl dtab apply' reads them, and every change is written back to
+it. With --seed, the delegation tables of the namerd given by --base-url
+or the context in use are copied at startup, replacing those read from
+--dir.
+
+Point namerctl at it with --base-url http://` + serveListen + `.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return errors.New("serve does not take arguments")
+			}
+
+			var store namer.Controller = namertest.NewController()
+			if serveDir != "" {
+				dir, err := newDirController(serveDir)
+				if err != nil {
+					return err
+				}
+				store = dir
+			}
+			if serveSeed {
+				if err := seedDtabs(store); err != nil {
+					return err
+				}
+			}
+
+			listener, err := net.Listen("tcp", serveListen)
+			if err != nil {
+				return err
+			}
+			server := &http.Server{Handler: namertest.NewHandler(store)}
+			go func() {
+				<-cmdContext.Done()
+				// Watches only end when their client goes away, so they
+				// are cut off after a grace period.
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+				if server.Shutdown(ctx) != nil {
+					server.Close()
+				}
+			}()
+
+			fmt.Fprintf(os.Stderr, "Serving namerd's API on http://%s\n", listener.Addr())
+			if err := server.Serve(listener); err != http.ErrServerClosed {
+				return err
+			}
+			return nil
+		},
+	}
+)
+
+func init() {
+	serveCmd.PersistentFlags().StringVar(&serveListen, "listen", serveListen,
+		"address to serve namerd's API on")
+	serveCmd.PersistentFlags().StringVar(&serveDir, "dir", "",
+		"directory of dtab files to serve and to write changes to")
+	serveCmd.PersistentFlags().BoolVar(&serveSeed, "seed", false,
+		"copy the dtabs of the namerd given by --base-url or --context at startup")
+	RootCmd.AddCommand(serveCmd)
+}
+
+// seedDtabs copies every dtab of the namerd in use to store.
+func seedDtabs(store namer.Controller) error {
+	source, err := getController()
+	if err != nil {
+		return err
+	}
+	names, err := namer.ListContext(cmdContext, source)
+	if err != nil {
+		return annotate(err, "seeding: %s", err)
+	}
+	for _, name := range names {
+		vd, err := namer.GetContext(cmdContext, source, name)
+		if err != nil {
+			return annotate(err, "seeding %s: %s", name, err)
+		}
+		_, err = namer.UpdateContext(cmdContext, store, name, vd.Dtab.String(), "")
+		if err == namer.ErrNotFound {
+			_, err = namer.CreateContext(cmdContext, store, name, vd.Dtab.String())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Seeded %d delegation tables\n", len(names))
+	return nil
+}
+
+// dirController is an in-memory Controller whose dtabs are also written
+// to a directory, one <namespace>.dtab file each.
+type dirController struct {
+	*namertest.Controller
+	dir string
+
+	// mu orders the writes of concurrent changes.
+	mu sync.Mutex
+	// sources are the files the dtabs were read from.
+	sources map[string]string
+}
+
+// newDirController reads the dtabs in dir, creating it if it does not
+// exist.
+func newDirController(dir string) (*dirController, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	locals, err := readLocalDtabs(dir)
+	if err != nil {
+		return nil, err
+	}
+	ctl := &dirController{
+		Controller: namertest.NewController(),
+		dir:        dir,
+		sources:    map[string]string{},
+	}
+	for _, local := range locals {
+		if _, err := ctl.Controller.Create(local.Namespace, local.Dtab.String()); err != nil {
+			return nil, annotate(err, "%s: %s", local.Source, err)
+		}
+		ctl.sources[local.Namespace] = local.Source
+	}
+	return ctl, nil
+}
+
+func (ctl *dirController) Create(name, dtabstr string) (namer.Version, error) {
+	return ctl.CreateContext(context.Background(), name, dtabstr)
+}
+
+func (ctl *dirController) CreateContext(ctx context.Context, name, dtabstr string) (namer.Version, error) {
+	if err := checkNamespaceFile(name); err != nil {
+		return "", err
+	}
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	version, err := ctl.Controller.CreateContext(ctx, name, dtabstr)
+	if err != nil {
+		return "", err
+	}
+	return version, ctl.write(name)
+}
+
+func (ctl *dirController) Update(name, dtabstr string, version namer.Version) (namer.Version, error) {
+	return ctl.UpdateContext(context.Background(), name, dtabstr, version)
+}
+
+func (ctl *dirController) UpdateContext(ctx context.Context, name, dtabstr string, version namer.Version) (namer.Version, error) {
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	version, err := ctl.Controller.UpdateContext(ctx, name, dtabstr, version)
+	if err != nil {
+		return "", err
+	}
+	return version, ctl.write(name)
+}
+
+func (ctl *dirController) Delete(name string) error {
+	return ctl.DeleteContext(context.Background(), name)
+}
+
+func (ctl *dirController) DeleteContext(ctx context.Context, name string) error {
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	if err := ctl.Controller.DeleteContext(ctx, name); err != nil {
+		return err
+	}
+	path := ctl.path(name)
+	delete(ctl.sources, name)
+	return os.Remove(path)
+}
+
+// path is the file of the named dtab.
+func (ctl *dirController) path(name string) string {
+	if source, ok := ctl.sources[name]; ok {
+		return source
+	}
+	return filepath.Join(ctl.dir, name+".dtab")
+}
+
+// write writes the named dtab to its file. A dtab read from a JSON file
+// is written to a .dtab file instead, and the JSON file removed.
+func (ctl *dirController) write(name string) error {
+	vd, err := ctl.Controller.Get(name)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(ctl.dir, name+".dtab")
+	// Hidden files are not read back as dtabs.
+	tmp := filepath.Join(ctl.dir, "."+name+".dtab.tmp")
+	if err := ioutil.WriteFile(tmp, []byte(vd.Dtab.Pretty()), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	if source := ctl.sources[name]; source != "" && source != path {
+		if err := os.Remove(source); err != nil {
+			return err
+		}
+	}
+	ctl.sources[name] = path
+	return nil
+}
+
+// checkNamespaceFile rejects namespace names that cannot be file names in
+// the directory.
+func checkNamespaceFile(name string) error {
+	if name == "" || name[0] == '.' || filepath.Base(name) != name {
+		return &namer.ErrBadRequest{Message: fmt.Sprintf("invalid namespace name '%s'", name)}
+	}
+	return nil
+}
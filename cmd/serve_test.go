@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linkerd/namerctl/namer"
+	"github.com/linkerd/namerctl/namer/namertest"
+)
+
+func TestServeConformance(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	ctl, err := newDirController(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(namertest.NewHandler(ctl))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	namertest.Conformance(t, func() namer.Controller {
+		return namer.NewHttpController(u, &http.Client{Timeout: time.Second},
+			namer.WithRetryPolicy(namer.RetryPolicy{InitialBackoff: 10 * time.Millisecond}))
+	})
+}
+
+func TestServeDir(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "old.json"), []byte(`{"dtab":[{"prefix":"/a","dst":"/b"}]}`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not a dtab"), 0644)
+
+	ctl, err := newDirController(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectFiles := func(expected ...string) {
+		infos, _ := ioutil.ReadDir(dir)
+		names := []string{}
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		if len(names) != len(expected) {
+			t.Fatalf("expected files %q, got %q", expected, names)
+		}
+		for i := range names {
+			if names[i] != expected[i] {
+				t.Fatalf("expected files %q, got %q", expected, names)
+			}
+		}
+	}
+
+	if _, err := ctl.Create("new", "/x=>/y"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ctl.Update("old", "/a=>/c", ""); err != nil {
+		t.Fatal(err)
+	}
+	expectFiles("README", "new.dtab", "old.dtab")
+	if _, err := ctl.Create("../escape", "/x=>/y"); err == nil {
+		t.Error("expected a namespace outside of the directory to be rejected")
+	}
+	if err := ctl.Delete("new"); err != nil {
+		t.Fatal(err)
+	}
+	expectFiles("README", "old.dtab")
+
+	// The dtabs are read back.
+	ctl, err = newDirController(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vd, err := ctl.Get("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vd.Dtab.String() != "/a=>/c;" {
+		t.Errorf("expected /a=>/c;, got %s", vd.Dtab)
+	}
+}
+
+type commandtest struct {
+	args   []string
+	stdout string
+	stderr string
+	status int
+}
+
+func TestServeCommands(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	served := filepath.Join(dir, "served")
+	config := filepath.Join(dir, ".namerctl.yaml")
+	files := map[string]string{
+		"web.dtab":     "# web\n/svc => /#/io.l5d.fs;\n",
+		"web-v2.dtab":  "/svc => /#/io.l5d.k8s;\n",
+		"invalid.dtab": "/svc => /#/io.l5d.fs |;\n",
+		"slash.dtab":   "/svc/ => /#/io.l5d.fs;\n",
+	}
+	for name, content := range files {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+	ioutil.WriteFile(config, nil, 0600)
+	file := func(name string) string { return filepath.Join(dir, name) }
+	// serve serves the dtabs in served the way 'namerctl serve --dir'
+	// does, and returns the arguments that point namerctl at it.
+	serve := func() (*httptest.Server, []string) {
+		ctl, err := newDirController(served)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := httptest.NewServer(namertest.NewHandler(ctl))
+		return server, []string{"--base-url", server.URL, "--retries", "0"}
+	}
+
+	server, base := serve()
+	tests := []commandtest{
+		{[]string{"dtab", "list"}, "\n", "", 0},
+		{[]string{"dtab", "create", "web", file("web.dtab")}, "Created web\n", "", 0},
+		{[]string{"dtab", "create", "web", file("web.dtab")},
+			"", "resource already exists\nUse `namerctl dtab update` to replace it.\n", exitAlreadyExists},
+		{[]string{"dtab", "list"}, "web\n", "", 0},
+		{[]string{"dtab", "get", "web"}, "# version 1\n/svc  => /#/io.l5d.fs ;\n", "", 0},
+		{[]string{"dtab", "get", "web", "--json"}, `{"version":"1","dtab":[{"prefix":"/svc","dst":"/#/io.l5d.fs"}]}` + "\n", "", 0},
+		{[]string{"dtab", "update", "web", file("web-v2.dtab"), "--version", "7"},
+			"", "resource was modified since it was fetched\n" +
+				"Fetch the current version with `namerctl dtab get` and try again, " +
+				"or use `namerctl dtab edit` to merge your changes into it.\n", exitVersionConflict},
+		{[]string{"dtab", "update", "web", file("web-v2.dtab"), "--version", "1"}, "Updated web\n", "", 0},
+		{[]string{"dtab", "get", "web", "--pretty=false"}, "/svc=>/#/io.l5d.k8s;\n", "", 0},
+		{[]string{"dtab", "create", "other", file("invalid.dtab")},
+			"", "invalid dtab:\n" + file("invalid.dtab") + ":1:23: expected a path, '(', '!', '~' or '$', found ';'\n" +
+				"/svc => /#/io.l5d.fs |;\n                      ^\n" +
+				"Run 'namerctl dtab create --help' for usage.\n", -1},
+		{[]string{"dtab", "create", "other", file("slash.dtab")},
+			"", "invalid dtab:\n" + file("slash.dtab") + ":1:5: prefix must not end with '/'\n" +
+				"/svc/ => /#/io.l5d.fs;\n    ^\n" +
+				"Run 'namerctl dtab create --help' for usage.\n", -1},
+		{[]string{"dtab", "create", ".hidden", file("web.dtab")},
+			"", "bad request: invalid namespace name '.hidden'\n" +
+				"namerd rejected the request; check the dtab with `namerctl dtab lint`.\n", exitBadRequest},
+		{[]string{"dtab", "update", "other", file("web.dtab")},
+			"", "resource was not found by ID or name\n" +
+				"List the existing delegation tables with `namerctl dtab list`.\n", exitNotFound},
+	}
+	for _, test := range tests {
+		stdout, stderr, status := runNamerctl(t, config, append(base, test.args...)...)
+		expectOutput(t, strings.Join(test.args, " "), stdout, stderr, status, test.stdout, test.stderr, test.status)
+	}
+
+	// The changes were written to the directory, and are served again
+	// after a restart.
+	server.Close()
+	if data, err := ioutil.ReadFile(filepath.Join(served, "web.dtab")); err != nil || string(data) != "/svc  => /#/io.l5d.k8s ;\n" {
+		t.Errorf("expected web.dtab to hold the update, got %q, %v", data, err)
+	}
+	server, base = serve()
+	defer server.Close()
+	tests = []commandtest{
+		{[]string{"dtab", "get", "web", "--pretty=false"}, "/svc=>/#/io.l5d.k8s;\n", "", 0},
+		{[]string{"dtab", "delete", "web"}, "Deleted web\n", "", 0},
+		{[]string{"dtab", "delete", "web"},
+			"", "resource was not found by ID or name\n" +
+				"List the existing delegation tables with `namerctl dtab list`.\n", exitNotFound},
+		{[]string{"dtab", "get", "web"},
+			"", "resource was not found by ID or name\n" +
+				"List the existing delegation tables with `namerctl dtab list`.\n", exitNotFound},
+	}
+	for _, test := range tests {
+		stdout, stderr, status := runNamerctl(t, config, append(base, test.args...)...)
+		expectOutput(t, strings.Join(test.args, " "), stdout, stderr, status, test.stdout, test.stderr, test.status)
+	}
+	if _, err := os.Stat(filepath.Join(served, "web.dtab")); !os.IsNotExist(err) {
+		t.Errorf("expected web.dtab to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// getTransport returns the transport for requests to namerd, configured
+// by the TLS settings, or nil to use http.DefaultTransport when there
+// are none.
+func getTransport(settings *viper.Viper) (http.RoundTripper, error) {
+	config, err := getTLSConfig(settings)
+	if err != nil || config == nil {
+		return nil, err
+	}
+	// The same settings as http.DefaultTransport, which cannot be copied.
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       config,
+	}, nil
+}
+
+// getTLSConfig builds the TLS configuration given by the ca-file,
+// cert-file, key-file, server-name and insecure-skip-verify settings. It
+// returns nil if none of them is set.
+func getTLSConfig(settings *viper.Viper) (*tls.Config, error) {
+	caFile := settings.GetString("ca-file")
+	certFile := settings.GetString("cert-file")
+	keyFile := settings.GetString("key-file")
+	serverName := settings.GetString("server-name")
+	insecure := settings.GetBool("insecure-skip-verify")
+	if caFile == "" && certFile == "" && keyFile == "" && serverName == "" && !insecure {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: insecure,
+	}
+
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA bundle: %s", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in %s", caFile)
+		}
+	}
+
+	switch {
+	case certFile != "" && keyFile != "":
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %s", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	case certFile != "":
+		return nil, errors.New("--cert-file requires --key-file")
+	case keyFile != "":
+		return nil, errors.New("--key-file requires --cert-file")
+	}
+
+	return config, nil
+}
+
+// describeTLSError returns a hint for a TLS handshake that failed because
+// namerd's certificate could not be verified, or "" for other errors.
+func describeTLSError(err error) string {
+	// Newer versions of crypto/tls wrap verification errors.
+	for {
+		wrapper, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			break
+		}
+		err = wrapper.Unwrap()
+	}
+	switch err.(type) {
+	case x509.UnknownAuthorityError:
+		return "namerd's certificate is not signed by a trusted CA; use --ca-file to trust its CA."
+	case x509.HostnameError:
+		return "namerd's certificate does not match its host name; use --server-name to expect another name."
+	case x509.CertificateInvalidError:
+		return "namerd's certificate is invalid; check that it has not expired."
+	}
+	return ""
+}
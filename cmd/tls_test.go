@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// testPKI is a CA with a certificate for namerd, valid for 127.0.0.1 and
+// namerd.test, and a client certificate, written as PEM files to dir.
+type testPKI struct {
+	dir        string
+	ca         *x509.Certificate
+	caKey      *ecdsa.PrivateKey
+	serverCert tls.Certificate
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	pki := &testPKI{dir: tempDir(t)}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "namerctl test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pki.ca, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	pki.caKey = key
+	pki.writePEM(t, "ca.pem", "CERTIFICATE", der)
+
+	pki.serverCert = pki.issue(t, "server", &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "namerd.test"},
+		DNSNames:    []string{"namerd.test"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	pki.issue(t, "client", &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "namerctl"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return pki
+}
+
+// issue signs template with the CA and writes the certificate and its
+// key to <name>.pem and <name>-key.pem.
+func (pki *testPKI) issue(t *testing.T, name string, template *x509.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	der, err := x509.CreateCertificate(rand.Reader, template, pki.ca, &key.PublicKey, pki.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pki.writePEM(t, name+".pem", "CERTIFICATE", der)
+	pki.writePEM(t, name+"-key.pem", "EC PRIVATE KEY", keyDER)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func (pki *testPKI) writePEM(t *testing.T, name, blockType string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := ioutil.WriteFile(pki.path(name), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (pki *testPKI) path(name string) string {
+	return filepath.Join(pki.dir, name)
+}
+
+// mtlsServer returns a server that requires a client certificate signed
+// by the CA.
+func (pki *testPKI) mtlsServer() *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(pki.ca)
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{pki.serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	// The failed handshakes are expected.
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	return server
+}
+
+type tlstest struct {
+	name     string
+	settings map[string]interface{}
+	// err is the start of the request's error, or "" if it succeeds.
+	err  string
+	hint string
+}
+
+func TestTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	defer os.RemoveAll(pki.dir)
+	server := pki.mtlsServer()
+	defer server.Close()
+
+	client := map[string]interface{}{
+		"cert-file": pki.path("client.pem"),
+		"key-file":  pki.path("client-key.pem"),
+	}
+	with := func(settings map[string]interface{}, more map[string]interface{}) map[string]interface{} {
+		merged := map[string]interface{}{}
+		for _, m := range []map[string]interface{}{settings, more} {
+			for key, value := range m {
+				merged[key] = value
+			}
+		}
+		return merged
+	}
+
+	tests := []tlstest{
+		{"mtls", with(client, map[string]interface{}{"ca-file": pki.path("ca.pem")}), "", ""},
+		{
+			"server name",
+			with(client, map[string]interface{}{"ca-file": pki.path("ca.pem"), "server-name": "namerd.test"}),
+			"", "",
+		},
+		{"insecure", with(client, map[string]interface{}{"insecure-skip-verify": true}), "", ""},
+		{
+			"unknown CA",
+			client,
+			"Get", "namerd's certificate is not signed by a trusted CA; use --ca-file to trust its CA.",
+		},
+		{
+			"wrong server name",
+			with(client, map[string]interface{}{"ca-file": pki.path("ca.pem"), "server-name": "other.test"}),
+			"Get", "namerd's certificate does not match its host name; use --server-name to expect another name.",
+		},
+		{
+			"no client certificate",
+			map[string]interface{}{"ca-file": pki.path("ca.pem")},
+			"Get", "",
+		},
+	}
+	for _, test := range tests {
+		settings := viper.New()
+		for key, value := range test.settings {
+			settings.Set(key, value)
+		}
+		transport, err := getTransport(settings)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		rsp, err := (&http.Client{Transport: transport, Timeout: 5 * time.Second}).Get(server.URL)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", test.name, err)
+			} else {
+				rsp.Body.Close()
+			}
+			continue
+		}
+		if err == nil {
+			rsp.Body.Close()
+			t.Errorf("%s: expected an error", test.name)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), test.err) {
+			t.Errorf("%s: expected an error starting with '%s', got '%s'", test.name, test.err, err)
+		}
+		if _, hint := describeError(err); hint != test.hint && test.hint != "" {
+			t.Errorf("%s: expected hint '%s', got '%s'", test.name, test.hint, hint)
+		}
+	}
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	pki := newTestPKI(t)
+	defer os.RemoveAll(pki.dir)
+	ioutil.WriteFile(pki.path("empty.pem"), []byte("not a certificate\n"), 0600)
+
+	tests := []tlstest{
+		{"none", map[string]interface{}{}, "", ""},
+		{
+			"missing CA file",
+			map[string]interface{}{"ca-file": pki.path("nope.pem")},
+			"reading CA bundle: open " + pki.path("nope.pem"), "",
+		},
+		{
+			"empty CA file",
+			map[string]interface{}{"ca-file": pki.path("empty.pem")},
+			"no PEM certificates found in " + pki.path("empty.pem"), "",
+		},
+		{
+			"cert without key",
+			map[string]interface{}{"cert-file": pki.path("client.pem")},
+			"--cert-file requires --key-file", "",
+		},
+		{
+			"key without cert",
+			map[string]interface{}{"key-file": pki.path("client-key.pem")},
+			"--key-file requires --cert-file", "",
+		},
+		{
+			"mismatched key",
+			map[string]interface{}{"cert-file": pki.path("client.pem"), "key-file": pki.path("server-key.pem")},
+			"loading client certificate: tls: private key does not match public key", "",
+		},
+		{
+			"missing key",
+			map[string]interface{}{"cert-file": pki.path("client.pem"), "key-file": pki.path("nope-key.pem")},
+			"loading client certificate: open " + pki.path("nope-key.pem"), "",
+		},
+	}
+	for _, test := range tests {
+		settings := viper.New()
+		for key, value := range test.settings {
+			settings.Set(key, value)
+		}
+		config, err := getTLSConfig(settings)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+		case test.err == "" && config != nil:
+			t.Errorf("%s: expected no TLS configuration, got %#v", test.name, config)
+		case test.err != "" && err == nil:
+			t.Errorf("%s: expected an error", test.name)
+		case test.err != "" && !strings.HasPrefix(err.Error(), test.err):
+			t.Errorf("%s: expected an error starting with '%s', got '%s'", test.name, test.err, err)
+		}
+	}
+}
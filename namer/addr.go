@@ -0,0 +1,151 @@
+package namer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The types of Addr, as named in namerd's JSON.
+const (
+	AddrTypeBound   = "bound"
+	AddrTypeNeg     = "neg"
+	AddrTypePending = "pending"
+	AddrTypeFailed  = "failed"
+)
+
+type (
+	// Addr is the set of addresses a bound name refers to. Only "bound"
+	// addrs have addresses; "failed" ones have a Cause.
+	Addr struct {
+		Type  string                 `json:"type"`
+		Addrs []*Address             `json:"addrs,omitempty"`
+		Meta  map[string]interface{} `json:"meta,omitempty"`
+		Cause string                 `json:"cause,omitempty"`
+	}
+
+	// Address is a concrete endpoint, with the metadata the namer
+	// attached to it.
+	Address struct {
+		IP   string                 `json:"ip"`
+		Port int                    `json:"port"`
+		Meta map[string]interface{} `json:"meta,omitempty"`
+	}
+)
+
+// Addr asks namerd for the addresses of the bound name id, such as
+// /#/io.l5d.fs/users, in the namespace ns.
+func (ctl *httpController) Addr(ctx context.Context, ns string, id Path) (*Addr, error) {
+	addr := &Addr{}
+	if err := ctl.getJSON(ctx, "addr/"+ns, pathQuery(id, nil), addr); err != nil {
+		return nil, err
+	}
+	return addr, nil
+}
+
+// WatchAddr streams the addresses of the bound name id in the namespace
+// ns, like Addr, starting with the current set and then each time it
+// changes.
+func (ctl *httpController) WatchAddr(ctx context.Context, ns string, id Path) (<-chan *Addr, error) {
+	return ctl.watchAddr(ctx, "watch of addr "+id.String(), "addr/"+ns, pathQuery(id, nil))
+}
+
+func (ctl *httpController) watchAddr(ctx context.Context, what, endpoint string, query url.Values) (<-chan *Addr, error) {
+	addrs := make(chan *Addr)
+	err := ctl.watchJSON(ctx, what, endpoint, query,
+		func(raw json.RawMessage) error {
+			addr := &Addr{}
+			if err := json.Unmarshal(raw, addr); err != nil {
+				return err
+			}
+			select {
+			case addrs <- addr:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+		func() { close(addrs) })
+	if err != nil {
+		return nil, err
+	}
+	return addrs, nil
+}
+
+// String renders the address as host:port.
+func (address *Address) String() string {
+	return net.JoinHostPort(address.IP, strconv.Itoa(address.Port))
+}
+
+// MetaString renders meta as comma-separated key=value pairs, sorted by
+// key.
+func MetaString(meta map[string]interface{}) string {
+	keys := make([]string, 0, len(meta))
+	for key := range meta {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = fmt.Sprintf("%s=%v", key, meta[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// DiffAddrs returns the addresses of new that are not in old and those of
+// old that are not in new, each sorted. Addresses are compared by host,
+// port and metadata, so an address whose metadata changed is both
+// removed and added. A nil Addr has no addresses.
+func DiffAddrs(old, new *Addr) (added, removed []*Address) {
+	oldSet := addressSet(old)
+	newSet := addressSet(new)
+	for key, address := range newSet {
+		if _, ok := oldSet[key]; !ok {
+			added = append(added, address)
+		}
+	}
+	for key, address := range oldSet {
+		if _, ok := newSet[key]; !ok {
+			removed = append(removed, address)
+		}
+	}
+	SortAddresses(added)
+	SortAddresses(removed)
+	return added, removed
+}
+
+func addressSet(addr *Addr) map[string]*Address {
+	set := map[string]*Address{}
+	if addr != nil {
+		for _, address := range addr.Addrs {
+			set[address.String()+" "+MetaString(address.Meta)] = address
+		}
+	}
+	return set
+}
+
+// SortAddresses sorts addresses by IP, then port.
+func SortAddresses(addresses []*Address) {
+	sort.Slice(addresses, func(i, j int) bool {
+		a, b := addresses[i], addresses[j]
+		if a.IP != b.IP {
+			return compareIPs(a.IP, b.IP) < 0
+		}
+		return a.Port < b.Port
+	})
+}
+
+// compareIPs orders IP addresses numerically when both parse, so that
+// 10.0.0.9 sorts before 10.0.0.10, and as strings otherwise.
+func compareIPs(a, b string) int {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return strings.Compare(a, b)
+	}
+	return strings.Compare(string(ipA.To16()), string(ipB.To16()))
+}
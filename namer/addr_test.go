@@ -0,0 +1,112 @@
+package namer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestAddr(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/1/addr/default" || r.URL.Query().Get("path") != "/#/io.l5d.fs/users" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		w.Write([]byte(`{"type":"bound","addrs":[
+		  {"ip":"10.0.0.10","port":80,"meta":{"nodeName":"b"}},
+		  {"ip":"10.0.0.9","port":80,"meta":{}}
+		],"meta":{}}`))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	ctl := NewHttpController(u, &http.Client{}).(Addresser)
+
+	addr, err := ctl.Addr(context.Background(), "default", Path{"#", "io.l5d.fs", "users"})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if addr.Type != AddrTypeBound || len(addr.Addrs) != 2 {
+		t.Fatalf("unexpected addr %+v", addr)
+	}
+	if meta := MetaString(addr.Addrs[0].Meta); meta != "nodeName=b" {
+		t.Errorf("expected meta nodeName=b, got %q", meta)
+	}
+}
+
+type addrdifftest struct {
+	old, new       *Addr
+	added, removed []string
+}
+
+var addrdifftests = []addrdifftest{
+	addrdifftest{
+		old:   nil,
+		new:   &Addr{Type: AddrTypeBound, Addrs: []*Address{{IP: "10.0.0.10", Port: 80}, {IP: "10.0.0.9", Port: 80}}},
+		added: []string{"10.0.0.9:80", "10.0.0.10:80"},
+	},
+	addrdifftest{
+		old:     &Addr{Type: AddrTypeBound, Addrs: []*Address{{IP: "10.0.0.1", Port: 80}, {IP: "10.0.0.2", Port: 80}}},
+		new:     &Addr{Type: AddrTypeBound, Addrs: []*Address{{IP: "10.0.0.2", Port: 80}, {IP: "10.0.0.3", Port: 80}}},
+		added:   []string{"10.0.0.3:80"},
+		removed: []string{"10.0.0.1:80"},
+	},
+	addrdifftest{
+		old:     &Addr{Type: AddrTypeBound, Addrs: []*Address{{IP: "::1", Port: 80}}},
+		new:     &Addr{Type: AddrTypeNeg},
+		removed: []string{"[::1]:80"},
+	},
+}
+
+func TestDiffAddrs(t *testing.T) {
+	for i, test := range addrdifftests {
+		added, removed := DiffAddrs(test.old, test.new)
+		if str, expected := addressStrings(added), addressStrings(nil, test.added...); str != expected {
+			t.Errorf("%d: expected added %s, got %s", i, expected, str)
+		}
+		if str, expected := addressStrings(removed), addressStrings(nil, test.removed...); str != expected {
+			t.Errorf("%d: expected removed %s, got %s", i, expected, str)
+		}
+	}
+}
+
+func addressStrings(addresses []*Address, strs ...string) string {
+	for _, address := range addresses {
+		strs = append(strs, address.String())
+	}
+	return fmt.Sprint(strs)
+}
+
+func TestResolve(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/1/resolve/default" || r.URL.Query().Get("path") != "/svc/users" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		if dtab := r.URL.Query().Get("dtab"); dtab != "/svc=>/#/io.l5d.fs;" {
+			t.Errorf("unexpected dtab parameter %q", dtab)
+		}
+		w.Write([]byte(`{"type":"bound","addrs":[
+		  {"ip":"10.0.0.1","port":80,"meta":{"endpoint_addr_weight":0.25}},
+		  {"ip":"10.0.0.2","port":80}
+		]}`))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	ctl := NewHttpController(u, &http.Client{}).(Resolver)
+
+	overlay, _ := ParseDtab("/svc=>/#/io.l5d.fs")
+	addr, err := ctl.Resolve(context.Background(), "default", Path{"svc", "users"}, overlay)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if len(addr.Addrs) != 2 {
+		t.Fatalf("unexpected addr %+v", addr)
+	}
+	if weight := addr.Addrs[0].Weight(); weight != 0.25 {
+		t.Errorf("expected weight 0.25, got %g", weight)
+	}
+	if weight := addr.Addrs[1].Weight(); weight != DefaultWeight {
+		t.Errorf("expected default weight, got %g", weight)
+	}
+}
@@ -0,0 +1,140 @@
+package namer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// TokenSource returns the bearer token to send with a request.
+type TokenSource func(ctx context.Context) (string, error)
+
+// StaticToken always returns token.
+func StaticToken(token string) TokenSource {
+	return func(context.Context) (string, error) {
+		return token, nil
+	}
+}
+
+// FileToken reads the token from the file at path. The file is read for
+// every request, so that a token rotated on disk is picked up.
+func FileToken(path string) TokenSource {
+	return func(context.Context) (string, error) {
+		token, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("reading token: %s", err)
+		}
+		return strings.TrimSpace(string(token)), nil
+	}
+}
+
+// CommandToken runs command, a credential helper, with sh and uses what
+// it prints as the token. The command is run once, for the first request.
+func CommandToken(command string) TokenSource {
+	var (
+		mu    sync.Mutex
+		token string
+	)
+	return func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if token != "" {
+			return token, nil
+		}
+
+		var stdout bytes.Buffer
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Stdout = &stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			return "", fmt.Errorf("running token command: %s", err)
+		}
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+		select {
+		case err := <-done:
+			if err != nil {
+				return "", fmt.Errorf("token command failed: %s", err)
+			}
+		case <-ctx.Done():
+			cmd.Process.Kill()
+			<-done
+			return "", ctx.Err()
+		}
+
+		token = strings.TrimSpace(stdout.String())
+		if token == "" {
+			return "", errors.New("token command printed no token")
+		}
+		return token, nil
+	}
+}
+
+// WithBearerToken authenticates every request with a token from source,
+// in an "Authorization: Bearer" header.
+func WithBearerToken(source TokenSource) Option {
+	return func(ctl *httpController) {
+		ctl.token = source
+	}
+}
+
+// WithBasicAuth authenticates every request with username and password.
+func WithBasicAuth(username, password string) Option {
+	return func(ctl *httpController) {
+		ctl.basicAuth = url.UserPassword(username, password)
+	}
+}
+
+// WithHeader adds header to every request, for example for a proxy in
+// front of namerd.
+func WithHeader(header http.Header) Option {
+	return func(ctl *httpController) {
+		if ctl.header == nil {
+			ctl.header = http.Header{}
+		}
+		for key, values := range header {
+			for _, value := range values {
+				ctl.header.Add(key, value)
+			}
+		}
+	}
+}
+
+// authenticate adds the controller's headers and credentials to req.
+func (ctl *httpController) authenticate(ctx context.Context, req *http.Request) error {
+	for key, values := range ctl.header {
+		req.Header[key] = append([]string(nil), values...)
+	}
+	if ctl.basicAuth != nil {
+		password, _ := ctl.basicAuth.Password()
+		req.SetBasicAuth(ctl.basicAuth.Username(), password)
+	}
+	if ctl.token != nil {
+		token, err := ctl.token(ctx)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+// redactURL renders u without the password of its user info.
+func redactURL(u *url.URL) string {
+	if u.User == nil {
+		return u.String()
+	}
+	redacted := *u
+	if _, ok := u.User.Password(); ok {
+		redacted.User = url.UserPassword(u.User.Username(), "REDACTED")
+	}
+	return redacted.String()
+}
@@ -0,0 +1,107 @@
+package namer
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+)
+
+type (
+	// BoundTree is the tree of names namerd binds a path to. Its nodes
+	// are typed like DelegateTree's, but only "leaf", "alt", "union",
+	// "neg", "fail" and "empty" nodes occur.
+	BoundTree struct {
+		Type string `json:"type"`
+
+		// Bound is set for "leaf" nodes.
+		Bound *BoundName `json:"bound,omitempty"`
+		// Alt is set for "alt" nodes, in order of preference.
+		Alt []*BoundTree `json:"alt,omitempty"`
+		// Union is set for "union" nodes.
+		Union []*WeightedBoundTree `json:"union,omitempty"`
+	}
+
+	// WeightedBoundTree is a branch of a "union" BoundTree.
+	WeightedBoundTree struct {
+		Weight float64    `json:"weight"`
+		Tree   *BoundTree `json:"tree"`
+	}
+)
+
+// Bind asks namerd to bind path in the namespace ns. If overlay is not
+// empty, its dentries are added to the namespace's dtab for this request
+// only, taking precedence over it.
+func (ctl *httpController) Bind(ctx context.Context, ns string, path Path, overlay Dtab) (*BoundTree, error) {
+	tree := &BoundTree{}
+	if err := ctl.getJSON(ctx, "bind/"+ns, pathQuery(path, overlay), tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// WatchBind streams the tree path is bound to in the namespace ns, like
+// Bind, starting with the current tree and then each time it changes.
+func (ctl *httpController) WatchBind(ctx context.Context, ns string, path Path, overlay Dtab) (<-chan *BoundTree, error) {
+	trees := make(chan *BoundTree)
+	err := ctl.watchJSON(ctx, "watch of bind "+path.String(), "bind/"+ns, pathQuery(path, overlay),
+		func(raw json.RawMessage) error {
+			tree := &BoundTree{}
+			if err := json.Unmarshal(raw, tree); err != nil {
+				return err
+			}
+			select {
+			case trees <- tree:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+		func() { close(trees) })
+	if err != nil {
+		return nil, err
+	}
+	return trees, nil
+}
+
+// pathQuery is the query of the endpoints that resolve a path, optionally
+// with a dtab overlay.
+func pathQuery(path Path, overlay Dtab) url.Values {
+	query := url.Values{"path": {path.String()}}
+	if len(overlay) > 0 {
+		query.Set("dtab", overlay.String())
+	}
+	return query
+}
+
+// NameTree returns the tree with each leaf replaced by the id of its bound
+// name, as namerd writes bound trees.
+func (tree *BoundTree) NameTree() NameTree {
+	switch tree.Type {
+	case DelegateTypeLeaf:
+		if tree.Bound == nil {
+			return Neg{}
+		}
+		return Leaf{Path: tree.Bound.ID}
+
+	case DelegateTypeAlt:
+		trees := make([]NameTree, len(tree.Alt))
+		for i, branch := range tree.Alt {
+			trees[i] = branch.NameTree()
+		}
+		return Alt{Trees: trees}
+
+	case DelegateTypeUnion:
+		trees := make([]Weighted, len(tree.Union))
+		for i, w := range tree.Union {
+			trees[i] = Weighted{Weight: w.Weight, Tree: w.Tree.NameTree()}
+		}
+		return Union{Trees: trees}
+
+	case DelegateTypeFail:
+		return Fail{}
+	case DelegateTypeEmpty:
+		return Empty{}
+	default:
+		return Neg{}
+	}
+}
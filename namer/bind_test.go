@@ -0,0 +1,95 @@
+package namer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const testBoundTree = `{"type":"alt","alt":[
+  {"type":"neg"},
+  {"type":"union","union":[
+    {"weight":0.25,"tree":{"type":"leaf","bound":{"id":"/#/io.l5d.fs/a","path":"/x"}}},
+    {"weight":0.75,"tree":{"type":"leaf","bound":{"id":"/#/io.l5d.fs/b","path":"/x"}}}
+  ]},
+  {"type":"fail"}
+]}`
+
+func TestBind(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/1/bind/default" {
+			t.Errorf("unexpected request path %s", r.URL.Path)
+		}
+		if path := r.URL.Query().Get("path"); path != "/svc/users/x" {
+			t.Errorf("unexpected path parameter %q", path)
+		}
+		if dtab := r.URL.Query().Get("dtab"); dtab != "/svc=>/#/io.l5d.fs;" {
+			t.Errorf("unexpected dtab parameter %q", dtab)
+		}
+		w.Write([]byte(testBoundTree))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	ctl := NewHttpController(u, &http.Client{}).(Binder)
+
+	overlay, err := ParseDtab("/svc=>/#/io.l5d.fs")
+	if err != nil {
+		t.Fatal("unexpected parse error", err)
+	}
+	tree, err := ctl.Bind(context.Background(), "default", Path{"svc", "users", "x"}, overlay)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	expected := "~ | 0.25 * /#/io.l5d.fs/a & 0.75 * /#/io.l5d.fs/b | !"
+	if str := tree.NameTree().String(); str != expected {
+		t.Errorf("expected bound tree '%s', got '%s'", expected, str)
+	}
+	if residual := tree.Alt[1].Union[0].Tree.Bound.Path.String(); residual != "/x" {
+		t.Errorf("expected residual path /x, got %s", residual)
+	}
+}
+
+func TestWatchBind(t *testing.T) {
+	// The second connection repeats the last tree before changing it.
+	batches := []string{
+		`{"type":"neg"}{"type":"leaf","bound":{"id":"/#/a","path":"/"}}`,
+		`{"type":"leaf","bound":{"id":"/#/a","path":"/"}}{"type":"leaf","bound":{"id":"/#/b","path":"/"}}`,
+	}
+	connections := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("watch") != "true" || r.URL.Query().Get("path") != "/svc" {
+			t.Errorf("expected a watch of /svc, got %s", r.URL)
+		}
+		if connections == len(batches) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(batches[connections]))
+		connections++
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	ctl := NewHttpController(u, &http.Client{Timeout: time.Second},
+		WithRetryPolicy(RetryPolicy{InitialBackoff: time.Millisecond})).(Binder)
+
+	trees, err := ctl.WatchBind(context.Background(), "default", Path{"svc"}, nil)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	got := []string{}
+	for tree := range trees {
+		got = append(got, tree.NameTree().String())
+	}
+	expected := []string{"~", "/#/a", "/#/b"}
+	if len(got) != len(expected) {
+		t.Fatalf("expected trees %q, got %q", expected, got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("expected tree %q, got %q", expected[i], got[i])
+		}
+	}
+}
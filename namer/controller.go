@@ -1,8 +1,8 @@
 package namer
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -10,8 +10,6 @@ import (
 	"strings"
 )
 
-// XXX later we should add support for parsing dtabs
-
 type (
 	Version       string
 	VersionedDtab struct {
@@ -19,6 +17,10 @@ type (
 		Dtab    Dtab    `json:"dtab"`
 	}
 
+	// Controller manages the dtabs of a namerd. It is all a controller
+	// must implement: the interfaces below are optional, and callers
+	// check for them with a type assertion. The controller returned by
+	// NewHttpController implements all of them.
 	Controller interface {
 		List() ([]string, error)
 		Get(name string) (*VersionedDtab, error)
@@ -27,38 +29,244 @@ type (
 		Update(name string, dtabstr string, version Version) (Version, error)
 	}
 
+	// ContextController is a Controller whose requests can be abandoned:
+	// the Context variants abandon their request when ctx is done and
+	// return ctx's error. ListContext and the other functions of the
+	// same names use them when a Controller has them.
+	ContextController interface {
+		Controller
+		ListContext(ctx context.Context) ([]string, error)
+		GetContext(ctx context.Context, name string) (*VersionedDtab, error)
+		CreateContext(ctx context.Context, name string, dtabstr string) (Version, error)
+		DeleteContext(ctx context.Context, name string) error
+		UpdateContext(ctx context.Context, name string, dtabstr string, version Version) (Version, error)
+	}
+
+	// Watcher is a Controller that can watch a dtab.
+	Watcher interface {
+		// Watch streams the named dtab, starting with its current
+		// version and then each time it changes. The channel is closed
+		// when ctx is done or when the dtab can no longer be watched.
+		Watch(ctx context.Context, name string) (<-chan *VersionedDtab, error)
+	}
+
+	// ListWatcher is a Controller that can watch the list of dtabs.
+	ListWatcher interface {
+		// WatchList streams an ADDED event for each existing dtab, then
+		// an event each time a dtab is created or deleted. The channel
+		// is closed when ctx is done or when the list can no longer be
+		// watched.
+		WatchList(ctx context.Context) (<-chan *NamespaceEvent, error)
+	}
+
+	// Binder is a Controller that can bind names.
+	Binder interface {
+		// Bind returns the tree of names path is bound to in a
+		// namespace, with the dentries of overlay, if any, added to its
+		// dtab.
+		Bind(ctx context.Context, ns string, path Path, overlay Dtab) (*BoundTree, error)
+		WatchBind(ctx context.Context, ns string, path Path, overlay Dtab) (<-chan *BoundTree, error)
+	}
+
+	// Addresser is a Controller that can look up the addresses of bound
+	// names.
+	Addresser interface {
+		// Addr returns the addresses of a bound name in a namespace.
+		Addr(ctx context.Context, ns string, id Path) (*Addr, error)
+		WatchAddr(ctx context.Context, ns string, id Path) (<-chan *Addr, error)
+	}
+
+	// Resolver is a Controller that can resolve names to addresses.
+	Resolver interface {
+		// Resolve returns the addresses path is resolved to in a
+		// namespace, with the dentries of overlay, if any, added to its
+		// dtab.
+		Resolve(ctx context.Context, ns string, path Path, overlay Dtab) (*Addr, error)
+		WatchResolve(ctx context.Context, ns string, path Path, overlay Dtab) (<-chan *Addr, error)
+	}
+
+	// Delegator is a Controller that can delegate names.
+	Delegator interface {
+		// Delegate returns the delegation tree of path in a namespace,
+		// as namerd's admin interface shows it.
+		Delegate(ctx context.Context, ns string, path Path, overlay Dtab) (*DelegateTree, error)
+	}
+
 	httpController struct {
 		baseURL *url.URL
 		client  *http.Client
+		retry   RetryPolicy
+		logger  Logger
+
+		// Credentials and headers added to every request.
+		token     TokenSource
+		basicAuth *url.Userinfo
+		header    http.Header
+
+		trace *tracer
+	}
+
+	// Option configures the Controller returned by NewHttpController.
+	Option func(*httpController)
+
+	// Logger receives messages about the requests a Controller makes.
+	// *log.Logger is a Logger.
+	Logger interface {
+		Printf(format string, args ...interface{})
 	}
 )
 
-func NewHttpController(baseURL *url.URL, client *http.Client) Controller {
-	return &httpController{baseURL, client}
+func NewHttpController(baseURL *url.URL, client *http.Client, opts ...Option) Controller {
+	ctl := &httpController{baseURL: baseURL, client: client}
+	for _, opt := range opts {
+		opt(ctl)
+	}
+	if ctl.trace != nil {
+		ctl.client = ctl.trace.traceClient(ctl.client, ctl.header)
+	}
+	return ctl
+}
+
+// ListContext is List, abandoned when ctx is done if ctl is a
+// ContextController.
+func ListContext(ctx context.Context, ctl Controller) ([]string, error) {
+	if ctl, ok := ctl.(ContextController); ok {
+		return ctl.ListContext(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return ctl.List()
+}
+
+// GetContext is Get, abandoned when ctx is done if ctl is a
+// ContextController.
+func GetContext(ctx context.Context, ctl Controller, name string) (*VersionedDtab, error) {
+	if ctl, ok := ctl.(ContextController); ok {
+		return ctl.GetContext(ctx, name)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return ctl.Get(name)
+}
+
+// CreateContext is Create, abandoned when ctx is done if ctl is a
+// ContextController.
+func CreateContext(ctx context.Context, ctl Controller, name, dtabstr string) (Version, error) {
+	if ctl, ok := ctl.(ContextController); ok {
+		return ctl.CreateContext(ctx, name, dtabstr)
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return ctl.Create(name, dtabstr)
+}
+
+// DeleteContext is Delete, abandoned when ctx is done if ctl is a
+// ContextController.
+func DeleteContext(ctx context.Context, ctl Controller, name string) error {
+	if ctl, ok := ctl.(ContextController); ok {
+		return ctl.DeleteContext(ctx, name)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ctl.Delete(name)
+}
+
+// UpdateContext is Update, abandoned when ctx is done if ctl is a
+// ContextController.
+func UpdateContext(ctx context.Context, ctl Controller, name, dtabstr string, version Version) (Version, error) {
+	if ctl, ok := ctl.(ContextController); ok {
+		return ctl.UpdateContext(ctx, name, dtabstr, version)
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return ctl.Update(name, dtabstr, version)
+}
+
+// WithLogger makes the controller report retries to logger.
+func WithLogger(logger Logger) Option {
+	return func(ctl *httpController) {
+		ctl.logger = logger
+	}
+}
+
+func (ctl *httpController) logf(format string, args ...interface{}) {
+	if ctl.logger != nil {
+		ctl.logger.Printf(format, args...)
+	}
+}
+
+func (ctl *httpController) dtabRequest(ctx context.Context, method, name string, data io.Reader) (*http.Request, error) {
+	return ctl.apiRequest(ctx, method, dtabEndpoint(name), nil, data)
+}
+
+// dtabEndpoint is the API endpoint of the named dtab, or of the list of
+// dtabs if name is empty.
+func dtabEndpoint(name string) string {
+	if name == "" {
+		return "dtabs"
+	}
+	return "dtabs/" + name
 }
 
-func (ctl *httpController) dtabRequest(method, name string, data io.Reader) (*http.Request, error) {
+// apiRequest builds a request for endpoint, such as "dtabs/default",
+// under namerd's /api/1/.
+func (ctl *httpController) apiRequest(ctx context.Context, method, endpoint string, query url.Values, data io.Reader) (*http.Request, error) {
 	u := *ctl.baseURL
 	if !strings.HasSuffix(u.Path, "/") {
 		u.Path += "/"
 	}
+	u.Path += "api/1/" + endpoint
+	u.RawQuery = query.Encode()
 
-	if name == "" {
-		u.Path += "api/1/dtabs"
-	} else {
-		u.Path += fmt.Sprintf("api/1/dtabs/%s", name)
+	req, err := http.NewRequest(method, u.String(), data)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctl.authenticate(ctx, req); err != nil {
+		return nil, err
+	}
+	return req.WithContext(ctx), nil
+}
+
+// getJSON fetches endpoint and decodes its JSON response into v.
+func (ctl *httpController) getJSON(ctx context.Context, endpoint string, query url.Values, v interface{}) error {
+	req, err := ctl.apiRequest(ctx, "GET", endpoint, query, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	rsp, _, err := ctl.do(ctx, req, retryAlways)
+	if err != nil {
+		return err
+	}
+	defer drainAndClose(rsp)
+
+	switch rsp.StatusCode {
+	case http.StatusOK:
+		return json.NewDecoder(rsp.Body).Decode(v)
+	default:
+		return responseError(rsp)
 	}
-	return http.NewRequest(method, u.String(), data)
 }
 
 func (ctl *httpController) List() ([]string, error) {
-	req, err := ctl.dtabRequest("GET", "", nil)
+	return ctl.ListContext(context.Background())
+}
+
+func (ctl *httpController) ListContext(ctx context.Context) ([]string, error) {
+	req, err := ctl.dtabRequest(ctx, "GET", "", nil)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Accept", "application/json")
 
-	rsp, err := ctl.client.Do(req)
+	rsp, _, err := ctl.do(ctx, req, retryAlways)
 	if err != nil {
 		return nil, err
 	}
@@ -74,18 +282,22 @@ func (ctl *httpController) List() ([]string, error) {
 		return names, nil
 
 	default:
-		return nil, fmt.Errorf("unexpected response: %s", rsp.Status)
+		return nil, responseError(rsp)
 	}
 }
 
 func (ctl *httpController) Get(name string) (*VersionedDtab, error) {
-	req, err := ctl.dtabRequest("GET", name, nil)
+	return ctl.GetContext(context.Background(), name)
+}
+
+func (ctl *httpController) GetContext(ctx context.Context, name string) (*VersionedDtab, error) {
+	req, err := ctl.dtabRequest(ctx, "GET", name, nil)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Accept", "application/json")
 
-	rsp, err := ctl.client.Do(req)
+	rsp, _, err := ctl.do(ctx, req, retryAlways)
 	if err != nil {
 		return nil, err
 	}
@@ -100,10 +312,8 @@ func (ctl *httpController) Get(name string) (*VersionedDtab, error) {
 			return nil, err
 		}
 		return &dtab, nil
-	case http.StatusNotFound:
-		return nil, ErrNotFound
 	default:
-		return nil, fmt.Errorf("unexpected response: %s", rsp.Status)
+		return nil, responseError(rsp)
 	}
 }
 
@@ -112,6 +322,10 @@ func isJson(str string) bool {
 }
 
 func (ctl *httpController) Create(name, dtabstr string) (Version, error) {
+	return ctl.CreateContext(context.Background(), name, dtabstr)
+}
+
+func (ctl *httpController) CreateContext(ctx context.Context, name, dtabstr string) (Version, error) {
 	emptyVersion := Version("")
 	var req *http.Request
 	var err error
@@ -125,20 +339,20 @@ func (ctl *httpController) Create(name, dtabstr string) (Version, error) {
 		if err != nil {
 			return emptyVersion, err
 		}
-		req, err = ctl.dtabRequest("POST", name, strings.NewReader(string(buf)))
+		req, err = ctl.dtabRequest(ctx, "POST", name, strings.NewReader(string(buf)))
 		if err != nil {
 			return emptyVersion, err
 		}
 		req.Header.Set("Content-Type", "application/json")
 	} else {
-		req, err = ctl.dtabRequest("POST", name, strings.NewReader(dtabstr))
+		req, err = ctl.dtabRequest(ctx, "POST", name, strings.NewReader(dtabstr))
 		if err != nil {
 			return emptyVersion, err
 		}
 		req.Header.Set("Content-Type", "application/dtab")
 	}
 
-	rsp, err := ctl.client.Do(req)
+	rsp, _, err := ctl.do(ctx, req, noRetry)
 	if err != nil {
 		return emptyVersion, err
 	}
@@ -150,17 +364,20 @@ func (ctl *httpController) Create(name, dtabstr string) (Version, error) {
 		return v, nil
 
 	default:
-		return emptyVersion, fmt.Errorf("unexpected response: %s", rsp.Status)
+		return emptyVersion, responseError(rsp)
 	}
 }
 
 func (ctl *httpController) Delete(name string) error {
+	return ctl.DeleteContext(context.Background(), name)
+}
 
-	req, err := ctl.dtabRequest("DELETE", name, nil)
+func (ctl *httpController) DeleteContext(ctx context.Context, name string) error {
+	req, err := ctl.dtabRequest(ctx, "DELETE", name, nil)
 	if err != nil {
 		return err
 	}
-	rsp, err := ctl.client.Do(req)
+	rsp, unsure, err := ctl.do(ctx, req, retryAlways)
 	if err != nil {
 		return err
 	}
@@ -170,13 +387,21 @@ func (ctl *httpController) Delete(name string) error {
 	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
 		return nil
 	case http.StatusNotFound:
-		return ErrNotFound
+		// An earlier attempt that failed after it was sent deleted it.
+		if unsure {
+			return nil
+		}
+		return responseError(rsp)
 	default:
-		return fmt.Errorf("unexpected response: %s", rsp.Status)
+		return responseError(rsp)
 	}
 }
 
 func (ctl *httpController) Update(name, dtabstr string, version Version) (Version, error) {
+	return ctl.UpdateContext(context.Background(), name, dtabstr, version)
+}
+
+func (ctl *httpController) UpdateContext(ctx context.Context, name, dtabstr string, version Version) (Version, error) {
 	useJSON := isJson(dtabstr)
 	if useJSON {
 		var vdtab VersionedDtab
@@ -195,7 +420,7 @@ func (ctl *httpController) Update(name, dtabstr string, version Version) (Versio
 		}
 	}
 
-	req, err := ctl.dtabRequest("PUT", name, strings.NewReader(dtabstr))
+	req, err := ctl.dtabRequest(ctx, "PUT", name, strings.NewReader(dtabstr))
 	if err != nil {
 		return Version(""), err
 	}
@@ -209,7 +434,15 @@ func (ctl *httpController) Update(name, dtabstr string, version Version) (Versio
 		req.Header.Set("Content-Type", "application/dtab")
 	}
 
-	rsp, err := ctl.client.Do(req)
+	// Only conditional updates are retried, so that a retry cannot
+	// overwrite a change made after the first attempt, and only when the
+	// failed attempt was not sent, so that a retry cannot fail with a
+	// version conflict caused by the attempt itself.
+	mode := noRetry
+	if version != "" {
+		mode = retryUnsent
+	}
+	rsp, _, err := ctl.do(ctx, req, mode)
 	if err != nil {
 		return Version(""), err
 	}
@@ -219,10 +452,30 @@ func (ctl *httpController) Update(name, dtabstr string, version Version) (Versio
 	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
 		v := Version(rsp.Header.Get("ETag"))
 		return v, nil
+	default:
+		return Version(""), responseError(rsp)
+	}
+}
+
+// maxErrorBody bounds how much of an error response is kept in errors.
+const maxErrorBody = 4096
+
+// responseError converts an unsuccessful response to one of the errors
+// documented in errors.go.
+func responseError(rsp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(rsp.Body, maxErrorBody))
+	msg := strings.TrimSpace(string(body))
+	switch rsp.StatusCode {
 	case http.StatusNotFound:
-		return Version(""), ErrNotFound
+		return ErrNotFound
+	case http.StatusConflict:
+		return ErrAlreadyExists
+	case http.StatusPreconditionFailed:
+		return ErrVersionConflict
+	case http.StatusBadRequest:
+		return &ErrBadRequest{Message: msg}
 	default:
-		return Version(""), fmt.Errorf("unexpected response: %s", rsp.Status)
+		return &APIError{StatusCode: rsp.StatusCode, Status: rsp.Status, Body: msg}
 	}
 }
 
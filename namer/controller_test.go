@@ -0,0 +1,62 @@
+package namer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+type errortest struct {
+	status int
+	body   string
+	err    error
+}
+
+var testerrors = []errortest{
+	errortest{http.StatusNotFound, "", ErrNotFound},
+	errortest{http.StatusConflict, "", ErrAlreadyExists},
+	errortest{http.StatusPreconditionFailed, "", ErrVersionConflict},
+	errortest{http.StatusBadRequest, "invalid dtab\n", &ErrBadRequest{Message: "invalid dtab"}},
+	errortest{
+		http.StatusInternalServerError,
+		"boom",
+		&APIError{StatusCode: 500, Status: "500 Internal Server Error", Body: "boom"},
+	},
+}
+
+func TestResponseErrors(t *testing.T) {
+	for _, test := range testerrors {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.status)
+			w.Write([]byte(test.body))
+		}))
+		u, _ := url.Parse(server.URL)
+		ctl := NewHttpController(u, &http.Client{})
+
+		_, err := ctl.Update("default", "/a=>/b", Version("1"))
+		if !reflect.DeepEqual(err, test.err) {
+			t.Errorf("%d: expected error %#v, got %#v", test.status, test.err, err)
+		}
+		server.Close()
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer server.Close()
+	defer close(block)
+	u, _ := url.Parse(server.URL)
+	ctl := NewHttpController(u, &http.Client{}).(ContextController)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go cancel()
+	if _, err := ctl.GetContext(ctx, "default"); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,311 @@
+package namer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// MaxDelegateDepth bounds the number of rewrites Delegate follows, as
+// Finagle does, so that rewrite loops terminate.
+const MaxDelegateDepth = 100
+
+// MaxDelegateNodes bounds the number of paths Delegate rewrites in all.
+// Dtabs whose rewrites multiply without repeating a path, such as
+// /svc=>/svc/a|/svc/b, would otherwise grow exponentially up to
+// MaxDelegateDepth.
+const MaxDelegateNodes = 1000
+
+// The types of DelegateTree nodes, as named in namerd's JSON.
+const (
+	DelegateTypeDelegate       = "delegate"
+	DelegateTypeLeaf           = "leaf"
+	DelegateTypeAlt            = "alt"
+	DelegateTypeUnion          = "union"
+	DelegateTypeNeg            = "neg"
+	DelegateTypeFail           = "fail"
+	DelegateTypeEmpty          = "empty"
+	DelegateTypeException      = "exception"
+	DelegateTypeTransformation = "transformation"
+)
+
+type (
+	// DelegateTree describes how a path was delegated: each node records
+	// the path being resolved and the dentry that produced it. It has the
+	// same shape as the trees served by namerd's delegator.
+	DelegateTree struct {
+		Type   string  `json:"type"`
+		Path   Path    `json:"path"`
+		Dentry *Dentry `json:"dentry,omitempty"`
+
+		// Delegate is set for "delegate" and "transformation" nodes.
+		Delegate *DelegateTree `json:"delegate,omitempty"`
+		// Alt is set for "alt" nodes, in order of preference.
+		Alt []*DelegateTree `json:"alt,omitempty"`
+		// Union is set for "union" nodes.
+		Union []*WeightedDelegateTree `json:"union,omitempty"`
+		// Bound is set for "leaf" nodes.
+		Bound *BoundName `json:"bound,omitempty"`
+		// Name is set for "transformation" nodes.
+		Name string `json:"name,omitempty"`
+		// Message is set for "exception" nodes.
+		Message string `json:"message,omitempty"`
+	}
+
+	// WeightedDelegateTree is a branch of a "union" DelegateTree.
+	WeightedDelegateTree struct {
+		Weight float64       `json:"weight"`
+		Tree   *DelegateTree `json:"tree"`
+	}
+
+	// BoundName is a name bound by a namer: ID identifies the bound
+	// name and Path is the residual path it was bound with. namerd also
+	// reports the name's addresses in Addr.
+	BoundName struct {
+		ID   Path  `json:"id"`
+		Path Path  `json:"path"`
+		Addr *Addr `json:"addr,omitempty"`
+	}
+)
+
+// Matches reports whether pfx is a prefix of path.
+func (pfx Prefix) Matches(path Path) bool {
+	if len(pfx) > len(path) {
+		return false
+	}
+	for i, elem := range pfx {
+		if !elem.Any && elem.Label != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// IsNamerPath reports whether path is handled by a namer rather than by
+// a dtab: namerd's configured namers live under /#/ and Finagle's system
+// namers under /$/.
+func IsNamerPath(path Path) bool {
+	return len(path) > 0 && (path[0] == "#" || path[0] == "$")
+}
+
+// Lookup rewrites path with every matching dentry, later dentries first,
+// as Finagle's Dtab.lookup does. Each returned tree has the unmatched
+// suffix of path appended to its leaves.
+func (dtab Dtab) Lookup(path Path) ([]*Dentry, []NameTree) {
+	dentries := []*Dentry{}
+	trees := []NameTree{}
+	for i := len(dtab) - 1; i >= 0; i-- {
+		d := dtab[i]
+		if d == nil || !d.Prefix.Matches(path) {
+			continue
+		}
+		dentries = append(dentries, d)
+		trees = append(trees, appendSuffix(d.Destination, path[len(d.Prefix):]))
+	}
+	return dentries, trees
+}
+
+func appendSuffix(tree NameTree, suffix Path) NameTree {
+	switch t := tree.(type) {
+	case Leaf:
+		return Leaf{Path: t.Path.Concat(suffix)}
+	case Alt:
+		trees := make([]NameTree, len(t.Trees))
+		for i, branch := range t.Trees {
+			trees[i] = appendSuffix(branch, suffix)
+		}
+		return Alt{Trees: trees}
+	case Union:
+		trees := make([]Weighted, len(t.Trees))
+		for i, w := range t.Trees {
+			trees[i] = Weighted{Weight: w.Weight, Tree: appendSuffix(w.Tree, suffix)}
+		}
+		return Union{Trees: trees}
+	default:
+		return tree
+	}
+}
+
+// Delegate resolves path through dtab locally, without contacting namerd.
+// Paths are rewritten recursively until they reach a namer (see
+// IsNamerPath), at which point delegation stops with a "leaf" node whose
+// bound id is the namer path itself. Rewrite loops, trees deeper than
+// MaxDelegateDepth and the rewrites beyond MaxDelegateNodes end in
+// "exception" nodes.
+func (dtab Dtab) Delegate(path Path) *DelegateTree {
+	d := &delegator{dtab: dtab}
+	return d.leaf(path, nil, nil)
+}
+
+type delegator struct {
+	dtab Dtab
+	// nodes counts the paths rewritten so far.
+	nodes int
+	// truncated is set once a rewrite was refused for exceeding
+	// MaxDelegateNodes.
+	truncated bool
+}
+
+// lookup builds the tree for every dentry matching path. chain holds the
+// paths rewritten so far on the way to path.
+func (d *delegator) lookup(path Path, chain []string) *DelegateTree {
+	dentries, trees := d.dtab.Lookup(path)
+	switch len(trees) {
+	case 0:
+		return &DelegateTree{Type: DelegateTypeNeg, Path: path}
+	case 1:
+		return d.tree(path, dentries[0], trees[0], chain)
+	default:
+		alt := &DelegateTree{Type: DelegateTypeAlt, Path: path}
+		for i, tree := range trees {
+			alt.Alt = append(alt.Alt, d.tree(path, dentries[i], tree, chain))
+		}
+		return alt
+	}
+}
+
+// tree converts the destination tree produced by dentry for path,
+// delegating each of its leaves in turn.
+func (d *delegator) tree(path Path, dentry *Dentry, tree NameTree, chain []string) *DelegateTree {
+	switch t := tree.(type) {
+	case Leaf:
+		return d.leaf(t.Path, dentry, chain)
+	case Alt:
+		alt := &DelegateTree{Type: DelegateTypeAlt, Path: path, Dentry: dentry}
+		for _, branch := range t.Trees {
+			alt.Alt = append(alt.Alt, d.tree(path, dentry, branch, chain))
+		}
+		return alt
+	case Union:
+		union := &DelegateTree{Type: DelegateTypeUnion, Path: path, Dentry: dentry}
+		for _, w := range t.Trees {
+			union.Union = append(union.Union, &WeightedDelegateTree{
+				Weight: w.Weight,
+				Tree:   d.tree(path, dentry, w.Tree, chain),
+			})
+		}
+		return union
+	case Fail:
+		return &DelegateTree{Type: DelegateTypeFail, Path: path, Dentry: dentry}
+	case Empty:
+		return &DelegateTree{Type: DelegateTypeEmpty, Path: path, Dentry: dentry}
+	default:
+		return &DelegateTree{Type: DelegateTypeNeg, Path: path, Dentry: dentry}
+	}
+}
+
+// leaf delegates path, which dentry rewrote another path into. The root
+// path has no dentry.
+func (d *delegator) leaf(path Path, dentry *Dentry, chain []string) *DelegateTree {
+	if IsNamerPath(path) {
+		return &DelegateTree{
+			Type:   DelegateTypeLeaf,
+			Path:   path,
+			Dentry: dentry,
+			Bound:  &BoundName{ID: path, Path: Path{}},
+		}
+	}
+
+	str := path.String()
+	for i, seen := range chain {
+		if seen == str {
+			return &DelegateTree{
+				Type:    DelegateTypeException,
+				Path:    path,
+				Dentry:  dentry,
+				Message: "delegation loop: " + strings.Join(append(chain[i:], str), " -> "),
+			}
+		}
+	}
+	if len(chain) > MaxDelegateDepth {
+		return &DelegateTree{
+			Type:    DelegateTypeException,
+			Path:    path,
+			Dentry:  dentry,
+			Message: fmt.Sprintf("max recursion depth %d reached", MaxDelegateDepth),
+		}
+	}
+	if d.nodes++; d.nodes > MaxDelegateNodes {
+		d.truncated = true
+		return &DelegateTree{
+			Type:    DelegateTypeException,
+			Path:    path,
+			Dentry:  dentry,
+			Message: fmt.Sprintf("delegation too large: more than %d rewrites", MaxDelegateNodes),
+		}
+	}
+
+	return &DelegateTree{
+		Type:     DelegateTypeDelegate,
+		Path:     path,
+		Dentry:   dentry,
+		Delegate: d.lookup(path, append(chain[:len(chain):len(chain)], str)),
+	}
+}
+
+// Result evaluates the tree the way Finagle binds it: alternates fall
+// back to their next branch while a branch is negative, and unions keep
+// only their non-negative branches. It returns a NameTree of bound ids;
+// exceptions evaluate to Fail.
+func (tree *DelegateTree) Result() NameTree {
+	switch tree.Type {
+	case DelegateTypeDelegate, DelegateTypeTransformation:
+		if tree.Delegate == nil {
+			return Neg{}
+		}
+		return tree.Delegate.Result()
+
+	case DelegateTypeLeaf:
+		if tree.Bound == nil {
+			return Leaf{Path: tree.Path}
+		}
+		return Leaf{Path: tree.Bound.ID}
+
+	case DelegateTypeAlt:
+		for _, branch := range tree.Alt {
+			if result := branch.Result(); !isNeg(result) {
+				return result
+			}
+		}
+		return Neg{}
+
+	case DelegateTypeUnion:
+		weighted := []Weighted{}
+		for _, w := range tree.Union {
+			if result := w.Tree.Result(); !isNeg(result) {
+				weighted = append(weighted, Weighted{Weight: w.Weight, Tree: result})
+			}
+		}
+		switch {
+		case len(weighted) == 0:
+			return Neg{}
+		case len(weighted) == 1:
+			return weighted[0].Tree
+		default:
+			return Union{Trees: weighted}
+		}
+
+	case DelegateTypeEmpty:
+		return Empty{}
+	case DelegateTypeFail, DelegateTypeException:
+		return Fail{}
+	default:
+		return Neg{}
+	}
+}
+
+func isNeg(tree NameTree) bool {
+	_, ok := tree.(Neg)
+	return ok
+}
+
+// Delegate asks namerd how it delegates path in the namespace ns, with
+// the dentries of overlay, if any, added to the namespace's dtab. Unlike
+// Dtab.Delegate, the leaves of the tree are bound by namerd's namers.
+func (ctl *httpController) Delegate(ctx context.Context, ns string, path Path, overlay Dtab) (*DelegateTree, error) {
+	tree := &DelegateTree{}
+	if err := ctl.getJSON(ctx, "delegate/"+ns, pathQuery(path, overlay), tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
@@ -0,0 +1,178 @@
+package namer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type delegatetest struct {
+	dtab   string
+	path   string
+	result string
+}
+
+var testdelegations = []delegatetest{
+	delegatetest{"/svc=>/#/io.l5d.fs", "/svc/users", "/#/io.l5d.fs/users"},
+	delegatetest{"/svc=>/#/io.l5d.fs", "/host/users", "~"},
+	delegatetest{"/svc=>/a;/svc=>/b;/b=>/#/b", "/svc/users", "/#/b/users"},
+	delegatetest{"/svc=>/#/a;/svc=>/b", "/svc/users", "/#/a/users"},
+	delegatetest{"/svc=>/#/a;/svc=>/b | /#/c", "/svc/users", "/#/c/users"},
+	delegatetest{"/svc/*/users=>/#/users;/svc=>/#/other", "/svc/prod/users", "/#/other/prod/users"},
+	delegatetest{"/svc=>/#/other;/svc/*/users=>/#/users", "/svc/prod/users/1", "/#/users/1"},
+	delegatetest{"/svc/*/users=>/#/users", "/svc/users", "~"},
+	delegatetest{
+		"/svc=>0.3*/a & 0.7*/b & /c;/a=>/#/a;/b=>/#/b",
+		"/svc/users",
+		"0.3 * /#/a/users & 0.7 * /#/b/users",
+	},
+	delegatetest{"/svc=>~ | /$/inet/localhost/4140", "/svc", "/$/inet/localhost/4140"},
+	delegatetest{"/svc=>!|/#/a", "/svc", "!"},
+	delegatetest{"/svc=>$", "/svc", "$"},
+	delegatetest{"/svc=>/host;/host=>/svc", "/svc/users", "!"},
+	delegatetest{"/#/io.l5d.fs=>/svc", "/#/io.l5d.fs/users", "/#/io.l5d.fs/users"},
+}
+
+func TestDelegate(t *testing.T) {
+	for _, test := range testdelegations {
+		dtab, err := ParseDtab(test.dtab)
+		if err != nil {
+			t.Fatal("unexpected parse error", err)
+		}
+		path, err := ParsePath(test.path)
+		if err != nil {
+			t.Fatal("unexpected parse error", err)
+		}
+		tree := dtab.Delegate(path)
+		if result := tree.Result().String(); result != test.result {
+			t.Errorf("%s with %s: expected %s, got %s", test.path, test.dtab, test.result, result)
+		}
+	}
+}
+
+func TestDelegateLoop(t *testing.T) {
+	dtab, err := ParseDtab("/svc=>/host;/host=>/svc")
+	if err != nil {
+		t.Fatal("unexpected parse error", err)
+	}
+	tree := dtab.Delegate(Path{"svc", "users"})
+	for tree.Type == DelegateTypeDelegate {
+		tree = tree.Delegate
+	}
+	if tree.Type != DelegateTypeException {
+		t.Fatalf("expected an exception, got %s", tree.Type)
+	}
+	expected := "delegation loop: /svc/users -> /host/users -> /svc/users"
+	if tree.Message != expected {
+		t.Errorf("expected message '%s', got '%s'", expected, tree.Message)
+	}
+}
+
+func TestDelegateTooLarge(t *testing.T) {
+	dtab, err := ParseDtab("/svc=>/svc/a | /svc/b")
+	if err != nil {
+		t.Fatal("unexpected parse error", err)
+	}
+	done := make(chan *DelegateTree)
+	go func() { done <- dtab.Delegate(Path{"svc", "users"}) }()
+	var tree *DelegateTree
+	select {
+	case tree = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("delegation did not terminate")
+	}
+
+	// The first branches reach MaxDelegateDepth before the rest are cut
+	// short.
+	tooLarge := fmt.Sprintf("delegation too large: more than %d rewrites", MaxDelegateNodes)
+	nodes, exceptions := 0, 0
+	var walk func(tree *DelegateTree)
+	walk = func(tree *DelegateTree) {
+		if tree == nil {
+			return
+		}
+		nodes++
+		if tree.Type == DelegateTypeException && tree.Message == tooLarge {
+			exceptions++
+		}
+		walk(tree.Delegate)
+		for _, alt := range tree.Alt {
+			walk(alt)
+		}
+	}
+	walk(tree)
+	if exceptions == 0 {
+		t.Errorf("expected exceptions with message '%s'", tooLarge)
+	}
+	if nodes > 4*MaxDelegateNodes {
+		t.Errorf("expected the tree to be bounded by MaxDelegateNodes, got %d nodes", nodes)
+	}
+	if result := tree.Result().String(); result != "!" {
+		t.Errorf("expected the result to fail, got %s", result)
+	}
+}
+
+func TestDelegateTreeJSON(t *testing.T) {
+	dtab, err := ParseDtab("/svc=>/#/io.l5d.fs")
+	if err != nil {
+		t.Fatal("unexpected parse error", err)
+	}
+	bytes, err := json.Marshal(dtab.Delegate(Path{"svc", "users"}))
+	if err != nil {
+		t.Fatal("unexpected encode error", err)
+	}
+	expected := strings.Join([]string{
+		`{"type":"delegate","path":"/svc/users","delegate":`,
+		`{"type":"leaf","path":"/#/io.l5d.fs/users","dentry":{"prefix":"/svc","dst":"/#/io.l5d.fs"},`,
+		`"bound":{"id":"/#/io.l5d.fs/users","path":"/"}}}`,
+	}, "")
+	if string(bytes) != expected {
+		t.Errorf("expected json:\n%s\ngot:\n%s", expected, bytes)
+	}
+
+	var decoded DelegateTree
+	if err := json.Unmarshal(bytes, &decoded); err != nil {
+		t.Fatal("unexpected decode error", err)
+	}
+	if result := decoded.Result().String(); result != "/#/io.l5d.fs/users" {
+		t.Errorf("unexpected result after decoding: %s", result)
+	}
+}
+
+func TestRemoteDelegate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/1/delegate/default" || r.URL.Query().Get("path") != "/svc/users" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		w.Write([]byte(`{"type":"delegate","path":"/svc/users","delegate":{
+		  "type":"alt","path":"/svc/users","alt":[
+		    {"type":"neg","path":"/host/users","dentry":{"prefix":"/svc","dst":"/host"}},
+		    {"type":"leaf","path":"/#/io.l5d.fs/users","dentry":{"prefix":"/svc","dst":"/#/io.l5d.fs"},
+		     "bound":{"id":"/#/io.l5d.fs/users","path":"/","addr":{"type":"bound","addrs":[{"ip":"10.0.0.1","port":80}]}}}
+		  ]}}`))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	ctl := NewHttpController(u, &http.Client{}).(Delegator)
+
+	tree, err := ctl.Delegate(context.Background(), "default", Path{"svc", "users"}, nil)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if result := tree.Result().String(); result != "/#/io.l5d.fs/users" {
+		t.Errorf("unexpected result %s", result)
+	}
+	leaf := tree.Delegate.Alt[1]
+	if leaf.Dentry == nil || leaf.Dentry.String() != "/svc=>/#/io.l5d.fs" {
+		t.Errorf("unexpected dentry %v", leaf.Dentry)
+	}
+	if leaf.Bound.Addr == nil || len(leaf.Bound.Addr.Addrs) != 1 {
+		t.Errorf("expected the leaf's addresses, got %+v", leaf.Bound)
+	}
+}
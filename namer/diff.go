@@ -0,0 +1,154 @@
+package namer
+
+// The types of DtabChange.
+const (
+	ChangeUnchanged = "unchanged"
+	ChangeAdded     = "added"
+	ChangeRemoved   = "removed"
+	ChangeModified  = "modified"
+	ChangeMoved     = "moved"
+)
+
+// DtabChange is one entry of the difference between two dtabs.
+type DtabChange struct {
+	Type string `json:"type"`
+	// OldIndex and NewIndex are the positions of the dentry in the old
+	// and new dtabs, or -1 when it is absent from one of them.
+	OldIndex int     `json:"oldIndex"`
+	NewIndex int     `json:"newIndex"`
+	Old      *Dentry `json:"old,omitempty"`
+	New      *Dentry `json:"new,omitempty"`
+}
+
+// DiffDtabs compares two dtabs dentry by dentry. The result lists every
+// dentry of both dtabs in order, so unchanged entries can be shown as
+// context. Dentries found in both dtabs but out of order are "moved",
+// and a removed and an added dentry with the same prefix are paired as
+// "modified"; both are listed at their position in the new dtab.
+func DiffDtabs(old, new Dtab) []*DtabChange {
+	oldStrs := dentryStrings(old)
+	newStrs := dentryStrings(new)
+	script := diffStrings(oldStrs, newStrs)
+
+	// Pair up removals and additions, first as moves of identical
+	// dentries and then as modifications of the same prefix.
+	removed := map[int]bool{}
+	added := []int{}
+	for _, e := range script {
+		if e.old >= 0 && e.new < 0 {
+			removed[e.old] = true
+		} else if e.new >= 0 && e.old < 0 {
+			added = append(added, e.new)
+		}
+	}
+	pairs := map[int]*DtabChange{}
+	pairedOld := map[int]bool{}
+	pair := func(typ string, same func(o, n int) bool) {
+		for _, n := range added {
+			if pairs[n] != nil {
+				continue
+			}
+			for o := range old {
+				if removed[o] && !pairedOld[o] && same(o, n) {
+					pairs[n] = &DtabChange{Type: typ, OldIndex: o, NewIndex: n, Old: old[o], New: new[n]}
+					pairedOld[o] = true
+					break
+				}
+			}
+		}
+	}
+	pair(ChangeMoved, func(o, n int) bool {
+		return oldStrs[o] == newStrs[n]
+	})
+	pair(ChangeModified, func(o, n int) bool {
+		return old[o] != nil && new[n] != nil && old[o].Prefix.String() == new[n].Prefix.String()
+	})
+
+	changes := []*DtabChange{}
+	for _, e := range script {
+		switch {
+		case e.old >= 0 && e.new >= 0:
+			changes = append(changes, &DtabChange{
+				Type: ChangeUnchanged, OldIndex: e.old, NewIndex: e.new, Old: old[e.old], New: new[e.new],
+			})
+		case e.old >= 0:
+			if !pairedOld[e.old] {
+				changes = append(changes, &DtabChange{
+					Type: ChangeRemoved, OldIndex: e.old, NewIndex: -1, Old: old[e.old],
+				})
+			}
+		default:
+			if c := pairs[e.new]; c != nil {
+				changes = append(changes, c)
+			} else {
+				changes = append(changes, &DtabChange{
+					Type: ChangeAdded, OldIndex: -1, NewIndex: e.new, New: new[e.new],
+				})
+			}
+		}
+	}
+	return changes
+}
+
+// HasChanges reports whether changes has any entry that is not unchanged.
+func HasChanges(changes []*DtabChange) bool {
+	for _, c := range changes {
+		if c.Type != ChangeUnchanged {
+			return true
+		}
+	}
+	return false
+}
+
+func dentryStrings(dtab Dtab) []string {
+	strs := make([]string, len(dtab))
+	for i, d := range dtab {
+		if d != nil {
+			strs[i] = d.String()
+		}
+	}
+	return strs
+}
+
+// strEdit pairs an index of the old list with one of the new list; an
+// index of -1 means the element was added or removed.
+type strEdit struct {
+	old, new int
+}
+
+// diffStrings aligns a and b along their longest common subsequence.
+func diffStrings(a, b []string) []strEdit {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	script := []strEdit{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			script = append(script, strEdit{i, j})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			script = append(script, strEdit{i, -1})
+			i++
+		default:
+			script = append(script, strEdit{-1, j})
+			j++
+		}
+	}
+	return script
+}
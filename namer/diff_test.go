@@ -0,0 +1,53 @@
+package namer
+
+import (
+	"fmt"
+	"testing"
+)
+
+type difftest struct {
+	old, new string
+	changes  []string
+}
+
+var testdiffs = []difftest{
+	difftest{"/a=>/x;/b=>/y", "/a=>/x;/b=>/y", []string{"unchanged 0 0", "unchanged 1 1"}},
+	difftest{"/a=>/x", "/a=>/x;/b=>/y", []string{"unchanged 0 0", "added -1 1"}},
+	difftest{"/a=>/x;/b=>/y", "/b=>/y", []string{"removed 0 -1", "unchanged 1 0"}},
+	difftest{"/a=>/x;/b=>/y", "/a=>/z;/b=>/y", []string{"modified 0 0", "unchanged 1 1"}},
+	difftest{
+		"/a=>/x;/b=>/y;/c=>/z",
+		"/b=>/y;/c=>/z;/a=>/x",
+		[]string{"unchanged 1 0", "unchanged 2 1", "moved 0 2"},
+	},
+	difftest{
+		"/a=>/x;/a=>/y",
+		"/a=>/y;/a=>/w;/b=>/v",
+		[]string{"unchanged 1 0", "modified 0 1", "added -1 2"},
+	},
+	difftest{"", "", []string{}},
+}
+
+func TestDiffDtabs(t *testing.T) {
+	for _, test := range testdiffs {
+		old, err := ParseDtab(test.old)
+		if err != nil {
+			t.Fatalf("%q: unexpected parse error %s", test.old, err)
+		}
+		new, err := ParseDtab(test.new)
+		if err != nil {
+			t.Fatalf("%q: unexpected parse error %s", test.new, err)
+		}
+		changes := DiffDtabs(old, new)
+		got := []string{}
+		for _, c := range changes {
+			got = append(got, fmt.Sprintf("%s %d %d", c.Type, c.OldIndex, c.NewIndex))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.changes) {
+			t.Errorf("%q -> %q: expected changes %v, got %v", test.old, test.new, test.changes, got)
+		}
+		if HasChanges(changes) != (test.old != test.new) {
+			t.Errorf("%q -> %q: unexpected HasChanges %v", test.old, test.new, HasChanges(changes))
+		}
+	}
+}
@@ -1,15 +1,20 @@
 package namer
 
 import (
+	"encoding/json"
 	"fmt"
-	"regexp"
-	"strings"
 )
 
 type (
+	// Dentry maps a Prefix to a destination NameTree. It is encoded as
+	// JSON the way namerd does, with both sides as strings.
 	Dentry struct {
-		Prefix      string `json:"prefix"`
-		Destination string `json:"dst"`
+		Prefix      Prefix   `json:"prefix"`
+		Destination NameTree `json:"dst"`
+		// Pos and End delimit the text the dentry was parsed from, if
+		// it was parsed from text. End is just after the destination.
+		Pos Position `json:"-"`
+		End Position `json:"-"`
 	}
 	Dtab []*Dentry
 )
@@ -18,32 +23,42 @@ func (dentry *Dentry) String() string {
 	return fmt.Sprintf("%s=>%s", dentry.Prefix, dentry.Destination)
 }
 
-var (
-	dentrySepRE *regexp.Regexp = regexp.MustCompile(`\s*;\s*`)
-)
+type jsonDentry struct {
+	Prefix      string `json:"prefix"`
+	Destination string `json:"dst"`
+}
 
-// ParseDtab reads a Dtab string into a list of Prefix and Destination
-// pairs. The dtab string must be validated and stripped of comments
-// before being parsed.
-func parseDtab(dtabStr string) (Dtab, error) {
-	dtabStr = strings.Replace(dtabStr, "\n", "", -1)
-	if dtabStr == "" {
-		return Dtab([]*Dentry{}), nil
+func (dentry Dentry) MarshalJSON() ([]byte, error) {
+	pfx, err := dentry.Prefix.MarshalText()
+	if err != nil {
+		return nil, err
 	}
-	dentryStrs := dentrySepRE.Split(dtabStr, -1)
-	dentries := []*Dentry{}
-	for _, dentryStr := range dentryStrs {
-		if dentryStr == "" {
-			continue
-		}
-		parts := strings.SplitN(dentryStr, "=>", 2)
-		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
-			return nil, fmt.Errorf("invalid dentry: '%s'", dentryStr)
-		}
-		dentries = append(dentries, &Dentry{parts[0], parts[1]})
+	if dentry.Destination == nil {
+		return nil, fmt.Errorf("dentry %s has no destination", dentry.Prefix)
+	}
+	dst, err := dentry.Destination.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonDentry{string(pfx), string(dst)})
+}
+
+func (dentry *Dentry) UnmarshalJSON(data []byte) error {
+	var jd jsonDentry
+	if err := json.Unmarshal(data, &jd); err != nil {
+		return err
+	}
+	pfx, err := ParsePrefix(jd.Prefix)
+	if err != nil {
+		return fmt.Errorf("invalid dentry prefix '%s': %s", jd.Prefix, err)
 	}
-	dtab := Dtab(dentries)
-	return dtab, nil
+	dst, err := ParseNameTree(jd.Destination)
+	if err != nil {
+		return fmt.Errorf("invalid dentry destination '%s': %s", jd.Destination, err)
+	}
+	dentry.Prefix = pfx
+	dentry.Destination = dst
+	return nil
 }
 
 func (dtab Dtab) String() string {
@@ -54,30 +69,21 @@ func (dtab Dtab) String() string {
 	return out
 }
 
+// Pretty renders the dtab one dentry per line with aligned arrows,
+// wrapping dentries that would be longer than MaxLineWidth.
 func (dtab Dtab) Pretty() string {
-	maxPfxLen := 0
+	width := 0
 	for _, d := range dtab {
-		if d == nil {
-			continue
-		}
-		l := len(d.Prefix)
-		if l > maxPfxLen {
-			maxPfxLen = l
+		if d != nil && len(d.Prefix.String()) > width {
+			width = len(d.Prefix.String())
 		}
 	}
 
 	str := ""
 	for _, d := range dtab {
-		if d == nil {
-			continue
-		}
-		arrow := "=>"
-		w := maxPfxLen - len(d.Prefix) + 2
-		if w != 0 {
-			arrowfmt := fmt.Sprintf("%% %ds", w)
-			arrow = fmt.Sprintf(arrowfmt, "=>")
+		if d != nil {
+			str += formatDentry(d, width) + "\n"
 		}
-		str += fmt.Sprintf("%s  %s %s ;\n", d.Prefix, arrow, d.Destination)
 	}
 	return str
 }
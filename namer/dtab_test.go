@@ -1,6 +1,11 @@
 package namer
 
-import "testing"
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
 
 type dtabtest struct {
 	text   string
@@ -11,24 +16,53 @@ type dtabtest struct {
 
 var testdtabs = []dtabtest{
 	dtabtest{"", true, []*Dentry{}, ""},
+	dtabtest{"# nothing but a comment; /a=>/b\n", true, []*Dentry{}, ""},
 	dtabtest{
 		"/foo=>/bar;/foo=>/bah#word",
 		true,
-		[]*Dentry{&Dentry{"/foo", "/bar"}, &Dentry{"/foo", "/bah#word"}},
+		[]*Dentry{dentry("/foo", leaf("bar")), dentry("/foo", leaf("bah#word"))},
 		"/foo  => /bar ;\n/foo  => /bah#word ;\n",
 	},
 	dtabtest{
 		"/foo=>/bar;/foo/bar/baz=>/bah#word;",
 		true,
-		[]*Dentry{&Dentry{"/foo", "/bar"}, &Dentry{"/foo/bar/baz", "/bah#word"}},
+		[]*Dentry{dentry("/foo", leaf("bar")), dentry("/foo/bar/baz", leaf("bah#word"))},
 		"/foo          => /bar ;\n/foo/bar/baz  => /bah#word ;\n",
 	},
 	dtabtest{
 		"/foo=>/bar;/foo/bar/baz=>/bah\n",
 		true,
-		[]*Dentry{&Dentry{"/foo", "/bar"}, &Dentry{"/foo/bar/baz", "/bah"}},
+		[]*Dentry{dentry("/foo", leaf("bar")), dentry("/foo/bar/baz", leaf("bah"))},
 		"/foo          => /bar ;\n/foo/bar/baz  => /bah ;\n",
 	},
+	dtabtest{
+		"# routes\n/svc => /#/io.l5d.fs ; # fs namer\n/svc/*/b => /a | ~;\n",
+		true,
+		[]*Dentry{
+			dentry("/svc", leaf("#", "io.l5d.fs")),
+			dentry("/svc/*/b", Alt{[]NameTree{leaf("a"), Neg{}}}),
+		},
+		"/svc      => /#/io.l5d.fs ;\n/svc/*/b  => /a | ~ ;\n",
+	},
+	dtabtest{"/foo", false, nil, ""},
+	dtabtest{"/foo=>/bar;;/baz", false, nil, ""},
+	dtabtest{"/foo=>/bar /baz", false, nil, ""},
+}
+
+func dentry(pfx string, dst NameTree) *Dentry {
+	elems := Prefix{}
+	for _, label := range strings.Split(pfx, "/")[1:] {
+		if label == "*" {
+			elems = append(elems, PrefixElem{Any: true})
+		} else {
+			elems = append(elems, PrefixElem{Label: label})
+		}
+	}
+	return &Dentry{Prefix: elems, Destination: dst}
+}
+
+func leaf(labels ...string) Leaf {
+	return Leaf{Path(labels)}
 }
 
 func eqDtabs(dtab0, dtab1 Dtab) bool {
@@ -36,7 +70,8 @@ func eqDtabs(dtab0, dtab1 Dtab) bool {
 		return false
 	}
 	for i, dentry0 := range dtab0 {
-		if dentry0.Prefix != dtab1[i].Prefix || dentry0.Destination != dtab1[i].Destination {
+		if !reflect.DeepEqual(dentry0.Prefix, dtab1[i].Prefix) ||
+			!reflect.DeepEqual(dentry0.Destination, dtab1[i].Destination) {
 			return false
 		}
 	}
@@ -45,7 +80,7 @@ func eqDtabs(dtab0, dtab1 Dtab) bool {
 
 func TestDtab(t *testing.T) {
 	for _, test := range testdtabs {
-		dtab, err := parseDtab(test.text)
+		dtab, err := ParseDtab(test.text)
 		if test.ok {
 			if err != nil {
 				t.Error("unexpected parse error", err)
@@ -65,3 +100,24 @@ func TestDtab(t *testing.T) {
 		}
 	}
 }
+
+func TestDentryJSON(t *testing.T) {
+	text := `[{"prefix":"/svc/*","dst":"/#/io.l5d.fs | 0.3 * /a & 0.7 * /b"}]`
+	var dtab Dtab
+	if err := json.Unmarshal([]byte(text), &dtab); err != nil {
+		t.Fatal("unexpected decode error", err)
+	}
+	bytes, err := json.Marshal(dtab)
+	if err != nil {
+		t.Fatal("unexpected encode error", err)
+	}
+	// encoding/json escapes '&' for safe embedding in HTML.
+	expected := strings.Replace(text, "&", `\u0026`, -1)
+	if string(bytes) != expected {
+		t.Errorf("expected json: '%s', got '%s'", expected, bytes)
+	}
+
+	if err := json.Unmarshal([]byte(`[{"prefix":"/svc","dst":"/a |"}]`), &dtab); err == nil {
+		t.Error("expected decode error got", dtab)
+	}
+}
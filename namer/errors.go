@@ -1,8 +1,145 @@
 package namer
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 var (
 	// ErrNotFound is returned by Get() or Update() when the resource was not found by ID.
 	ErrNotFound = errors.New("resource was not found by ID or name")
+
+	// ErrVersionConflict is returned by Update() when the resource was
+	// modified since the version it was given (412 Precondition Failed).
+	ErrVersionConflict = errors.New("resource was modified since it was fetched")
+
+	// ErrAlreadyExists is returned by Create() when a resource with the
+	// same name exists (409 Conflict).
+	ErrAlreadyExists = errors.New("resource already exists")
+)
+
+type (
+	// ErrBadRequest is returned when namerd rejects a request as invalid
+	// (400 Bad Request), typically because it could not parse a dtab.
+	ErrBadRequest struct {
+		// Message is the explanation sent by namerd, if any.
+		Message string
+	}
+
+	// ErrUnsupported is returned when a Controller does not implement
+	// the optional interface an operation needs, such as Watcher.
+	ErrUnsupported struct {
+		// Operation is what was asked of the controller, such as
+		// "watching dtabs".
+		Operation string
+	}
+
+	// APIError is returned for responses with an unexpected status.
+	APIError struct {
+		StatusCode int
+		Status     string
+		// Body is the start of the response body.
+		Body string
+	}
+
+	// Position is a location in dtab source text. Line and Column are
+	// 1-based; Column counts bytes.
+	Position struct {
+		Filename string `json:"filename,omitempty"`
+		Offset   int    `json:"offset"`
+		Line     int    `json:"line"`
+		Column   int    `json:"column"`
+	}
+
+	// ParseError is a syntax error in a dtab.
+	ParseError struct {
+		Pos Position
+		Msg string
+		// Source is the full text of the line containing the error.
+		Source string
+	}
+
+	// ErrorList is the list of every syntax error found in a dtab.
+	ErrorList []*ParseError
 )
+
+func (err *ErrBadRequest) Error() string {
+	if err.Message == "" {
+		return "bad request"
+	}
+	return "bad request: " + err.Message
+}
+
+func (err *ErrUnsupported) Error() string {
+	return err.Operation + " is not supported by this controller"
+}
+
+func (err *APIError) Error() string {
+	if err.Body == "" {
+		return fmt.Sprintf("unexpected response: %s", err.Status)
+	}
+	return fmt.Sprintf("unexpected response: %s: %s", err.Status, err.Body)
+}
+
+func (pos Position) String() string {
+	s := fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	if pos.Filename != "" {
+		s = pos.Filename + ":" + s
+	}
+	return s
+}
+
+// IsValid reports whether pos refers to a location in source text.
+func (pos Position) IsValid() bool {
+	return pos.Line > 0
+}
+
+func position(filename, src string, offset int) Position {
+	lineStart := strings.LastIndex(src[:offset], "\n") + 1
+	return Position{
+		Filename: filename,
+		Offset:   offset,
+		Line:     strings.Count(src[:offset], "\n") + 1,
+		Column:   offset - lineStart + 1,
+	}
+}
+
+func newParseError(filename, src string, offset int, msg string) *ParseError {
+	pos := position(filename, src, offset)
+	lineStart := offset - pos.Column + 1
+	lineEnd := strings.IndexByte(src[offset:], '\n')
+	if lineEnd == -1 {
+		lineEnd = len(src)
+	} else {
+		lineEnd += offset
+	}
+	return &ParseError{Pos: pos, Msg: msg, Source: strings.TrimRight(src[lineStart:lineEnd], "\r")}
+}
+
+func (err *ParseError) Error() string {
+	return fmt.Sprintf("%s: %s", err.Pos, err.Msg)
+}
+
+// Excerpt returns the offending source line followed by a line with a
+// caret under the error's column.
+func (err *ParseError) Excerpt() string {
+	pad := []byte{}
+	for i := 0; i < err.Pos.Column-1 && i < len(err.Source); i++ {
+		if err.Source[i] == '\t' {
+			pad = append(pad, '\t')
+		} else {
+			pad = append(pad, ' ')
+		}
+	}
+	return fmt.Sprintf("%s\n%s^", err.Source, pad)
+}
+
+// Error lists every error, one per line.
+func (list ErrorList) Error() string {
+	strs := make([]string, len(list))
+	for i, err := range list {
+		strs[i] = err.Error()
+	}
+	return strings.Join(strs, "\n")
+}
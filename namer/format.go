@@ -0,0 +1,150 @@
+package namer
+
+import "strings"
+
+// MaxLineWidth is the width beyond which formatted dentries have their
+// alternates and unions wrapped onto separate lines.
+const MaxLineWidth = 80
+
+// Format parses src and returns it in canonical form: one dentry per
+// line terminated by " ;", arrows aligned within each run of dentries not
+// separated by blank lines, long destinations wrapped, and runs of blank
+// lines collapsed to one. Comments are preserved; comments inside a
+// dentry are moved to the line above it.
+func Format(filename string, src []byte) ([]byte, error) {
+	file, err := ParseFile(filename, string(src))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(file.Format()), nil
+}
+
+type fmtItem struct {
+	dentry   *Dentry
+	comment  *Comment
+	trailing *Comment
+	// blank is set when the item is preceded by a blank line.
+	blank bool
+}
+
+// Format renders the file in canonical form. See Format.
+func (file *File) Format() string {
+	items := file.fmtItems()
+
+	lines := []string{}
+	for i := 0; i < len(items); {
+		// Dentries are aligned in blocks that end at a blank line.
+		j := i + 1
+		for j < len(items) && !items[j].blank {
+			j++
+		}
+		width := 0
+		for _, item := range items[i:j] {
+			if item.dentry != nil && len(item.dentry.Prefix.String()) > width {
+				width = len(item.dentry.Prefix.String())
+			}
+		}
+
+		if i > 0 {
+			lines = append(lines, "")
+		}
+		for _, item := range items[i:j] {
+			if item.comment != nil {
+				lines = append(lines, item.comment.Text)
+				continue
+			}
+			line := formatDentry(item.dentry, width)
+			if item.trailing != nil {
+				line += " " + item.trailing.Text
+			}
+			lines = append(lines, line)
+		}
+		i = j
+	}
+
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// fmtItems lists the dentries and comments of the file in order,
+// attaching comments that follow a dentry on its last line to it.
+func (file *File) fmtItems() []*fmtItem {
+	items := []*fmtItem{}
+	comments := file.Comments
+	prevEnd := 0
+	var prev *fmtItem
+
+	takeComment := func() *Comment {
+		c := comments[0]
+		comments = comments[1:]
+		return c
+	}
+	addComments := func(before int) {
+		for len(comments) > 0 && comments[0].Pos.Offset < before {
+			c := takeComment()
+			if prev != nil && prev.dentry != nil && prev.trailing == nil &&
+				c.Pos.Line == prev.dentry.End.Line {
+				prev.trailing = c
+			} else {
+				prev = &fmtItem{comment: c, blank: file.blankBetween(prevEnd, c.Pos.Offset)}
+				items = append(items, prev)
+			}
+			prevEnd = c.Pos.Offset + len(c.Text)
+		}
+	}
+
+	for _, d := range file.Dtab {
+		if d == nil {
+			continue
+		}
+		addComments(d.Pos.Offset)
+
+		blank := file.blankBetween(prevEnd, d.Pos.Offset)
+		for len(comments) > 0 && comments[0].Pos.Offset < d.End.Offset {
+			items = append(items, &fmtItem{comment: takeComment(), blank: blank})
+			blank = false
+		}
+		prev = &fmtItem{dentry: d, blank: blank}
+		items = append(items, prev)
+		prevEnd = d.End.Offset
+	}
+	addComments(len(file.src) + 1)
+
+	if len(items) > 0 {
+		items[0].blank = false
+	}
+	return items
+}
+
+// blankBetween reports whether the source between two offsets contains
+// a line with nothing but whitespace.
+func (file *File) blankBetween(start, end int) bool {
+	if end > len(file.src) || start >= end {
+		return false
+	}
+	lines := strings.Split(file.src[start:end], "\n")
+	if len(lines) < 3 {
+		return false
+	}
+	for _, line := range lines[1 : len(lines)-1] {
+		if strings.TrimSpace(line) == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// formatDentry renders d with its prefix padded to width. Destinations
+// that would not fit in MaxLineWidth are wrapped with their alternates
+// and unions starting below the "=>".
+func formatDentry(d *Dentry, width int) string {
+	pfx := d.Prefix.String()
+	head := pfx + strings.Repeat(" ", width-len(pfx)) + "  => "
+	dst := d.Destination.String()
+	if len(head)+len(dst)+2 > MaxLineWidth {
+		dst = prettyTree(d.Destination, strings.Repeat(" ", len(head)-3))
+	}
+	return head + dst + " ;"
+}
@@ -0,0 +1,57 @@
+package namer
+
+import "testing"
+
+type fmttest struct {
+	src       string
+	formatted string
+}
+
+var testfmts = []fmttest{
+	fmttest{"", ""},
+	fmttest{"\n\n# just a comment\n\n", "# just a comment\n"},
+	fmttest{
+		"/foo=>/bar;/foo/bar/baz=>/bah",
+		"/foo          => /bar ;\n/foo/bar/baz  => /bah ;\n",
+	},
+	fmttest{
+		"# header; with => punctuation\n\n\n/svc=>/#/io.l5d.fs;   # fs namer\n/svc/users => /a|/b;\n\n# canaries\n/svc/web=>0.9*/host/web&0.1*/host/canary ;\n",
+		"# header; with => punctuation\n\n" +
+			"/svc        => /#/io.l5d.fs ; # fs namer\n" +
+			"/svc/users  => /a | /b ;\n\n" +
+			"# canaries\n" +
+			"/svc/web  => 0.9 * /host/web & 0.1 * /host/canary ;\n",
+	},
+	fmttest{
+		"/svc => /a # first\n  | /b # second\n;\n/x => /y",
+		"# first\n/svc  => /a | /b ; # second\n/x    => /y ;\n",
+	},
+	fmttest{
+		"/svc => /#/io.l5d.k8s/default/http/world-v1 | /#/io.l5d.k8s/default/http/world-v2 | /#/io.l5d.fs/world;",
+		"/svc  => /#/io.l5d.k8s/default/http/world-v1\n" +
+			"      | /#/io.l5d.k8s/default/http/world-v2\n" +
+			"      | /#/io.l5d.fs/world ;\n",
+	},
+}
+
+func TestFormat(t *testing.T) {
+	for _, test := range testfmts {
+		formatted, err := Format("test.dtab", []byte(test.src))
+		if err != nil {
+			t.Errorf("%q: unexpected error %s", test.src, err)
+			continue
+		}
+		if string(formatted) != test.formatted {
+			t.Errorf("%q: expected:\n%s\ngot:\n%s", test.src, test.formatted, formatted)
+			continue
+		}
+
+		// Formatting is idempotent.
+		again, err := Format("test.dtab", formatted)
+		if err != nil {
+			t.Errorf("%q: unexpected error reformatting %s", test.src, err)
+		} else if string(again) != string(formatted) {
+			t.Errorf("%q: reformatting changed:\n%s\nto:\n%s", test.src, formatted, again)
+		}
+	}
+}
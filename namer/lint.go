@@ -0,0 +1,303 @@
+package namer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severities of lint problems.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Names of the checks performed by Lint.
+const (
+	LintDuplicate     = "duplicate"
+	LintShadowed      = "shadowed"
+	LintUnresolvable  = "unresolvable"
+	LintUnknownNamer  = "unknown-namer"
+	LintZeroWeight    = "zero-weight"
+	LintTrailingSlash = "trailing-slash"
+	LintTooLarge      = "too-large"
+)
+
+// DefaultNamers are the namers that Lint assumes are configured in
+// namerd when LintOptions.Namers is nil. Each is addressed as /#/<name>.
+var DefaultNamers = []string{
+	"io.l5d.consul",
+	"io.l5d.curator",
+	"io.l5d.dnssrv",
+	"io.l5d.fs",
+	"io.l5d.k8s",
+	"io.l5d.k8s.external",
+	"io.l5d.k8s.ns",
+	"io.l5d.marathon",
+	"io.l5d.rancher",
+	"io.l5d.serversets",
+	"io.l5d.zkLeader",
+}
+
+type (
+	// LintOptions configures Lint.
+	LintOptions struct {
+		// Namers lists the prefixes of the namers configured in namerd,
+		// such as "io.l5d.fs" for /#/io.l5d.fs or "k8s/prod" for
+		// /#/k8s/prod. Nil means DefaultNamers.
+		Namers []string
+	}
+
+	// LintProblem is a suspicious dentry found by Lint.
+	LintProblem struct {
+		Check    string `json:"check"`
+		Severity string `json:"severity"`
+		// Index is the position of the dentry in the dtab.
+		Index   int      `json:"index"`
+		Dentry  *Dentry  `json:"dentry"`
+		Pos     Position `json:"position"`
+		Message string   `json:"message"`
+	}
+)
+
+func (problem *LintProblem) String() string {
+	return fmt.Sprintf("%s: %s (%s)", problem.Severity, problem.Message, problem.Check)
+}
+
+// Lint reports dentries of dtab that are redundant or cannot work:
+//
+//   - duplicate: the dentry repeats an earlier one exactly.
+//   - shadowed: a later dentry matches every path this one does and always
+//     resolves, assuming the system namers under /$/ bind whatever they
+//     are given. Fallbacks onto /#/ namers, which may be negative at
+//     runtime, are not reported.
+//   - unresolvable: delegating the destination loops or never terminates.
+//   - unknown-namer: the destination refers to a /#/ namer that is not
+//     listed in the options.
+//   - zero-weight: a union branch has a weight of zero and never gets
+//     traffic.
+//   - trailing-slash: the prefix ends with a '/', so it matches no path.
+//   - too-large: delegating the destination rewrites more than
+//     MaxDelegateNodes paths, so it was not checked for the other
+//     problems that need delegating it.
+func Lint(dtab Dtab, opts LintOptions) []*LintProblem {
+	namers := opts.Namers
+	if namers == nil {
+		namers = DefaultNamers
+	}
+	l := &linter{dtab: dtab, namers: namers}
+	for i, dentry := range dtab {
+		if dentry == nil {
+			continue
+		}
+		l.lintPrefix(i, dentry)
+		if !l.lintDuplicate(i, dentry) {
+			l.lintShadowed(i, dentry)
+		}
+		l.lintUnresolvable(i, dentry)
+		l.lintTree(i, dentry, dentry.Destination)
+	}
+	return l.problems
+}
+
+type linter struct {
+	dtab     Dtab
+	namers   []string
+	problems []*LintProblem
+}
+
+func (l *linter) report(check, severity string, i int, format string, args ...interface{}) {
+	l.problems = append(l.problems, &LintProblem{
+		Check:    check,
+		Severity: severity,
+		Index:    i,
+		Dentry:   l.dtab[i],
+		Pos:      l.dtab[i].Pos,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// describe names dentry i for messages, by position when it has one.
+func (l *linter) describe(i int) string {
+	if pos := l.dtab[i].Pos; pos.IsValid() {
+		return fmt.Sprintf("dentry at %d:%d (%s)", pos.Line, pos.Column, l.dtab[i])
+	}
+	return fmt.Sprintf("dentry %d (%s)", i, l.dtab[i])
+}
+
+func (l *linter) lintPrefix(i int, dentry *Dentry) {
+	if dentry.Prefix.TrailingSlash() {
+		l.report(LintTrailingSlash, SeverityError, i,
+			"prefix %s has a trailing slash and matches no path", dentry.Prefix)
+	}
+}
+
+func (l *linter) lintDuplicate(i int, dentry *Dentry) bool {
+	str := dentry.String()
+	for j := 0; j < i; j++ {
+		if l.dtab[j] != nil && l.dtab[j].String() == str {
+			l.report(LintDuplicate, SeverityWarning, i, "duplicates %s", l.describe(j))
+			return true
+		}
+	}
+	return false
+}
+
+func (l *linter) lintShadowed(i int, dentry *Dentry) {
+	path := prefixPath(dentry.Prefix)
+	for j := len(l.dtab) - 1; j > i; j-- {
+		later := l.dtab[j]
+		if later == nil || !later.Prefix.Covers(dentry.Prefix) {
+			continue
+		}
+		tree, truncated := l.delegate(later, path)
+		if truncated {
+			continue
+		}
+		result := tree.Result()
+		if !isNeg(result) && !dependsOnNamers(result) {
+			l.report(LintShadowed, SeverityWarning, i, "is shadowed by %s", l.describe(j))
+			return
+		}
+	}
+}
+
+func (l *linter) lintUnresolvable(i int, dentry *Dentry) {
+	tree, truncated := l.delegate(dentry, prefixPath(dentry.Prefix))
+	if truncated {
+		l.report(LintTooLarge, SeverityWarning, i,
+			"delegation too large: destination rewrites more than %d paths", MaxDelegateNodes)
+		return
+	}
+	if _, ok := tree.Result().(Fail); !ok {
+		return
+	}
+	if msg := firstException(tree); msg != "" {
+		l.report(LintUnresolvable, SeverityError, i, "destination never resolves: %s", msg)
+	}
+}
+
+func (l *linter) lintTree(i int, dentry *Dentry, tree NameTree) {
+	switch t := tree.(type) {
+	case Leaf:
+		if len(t.Path) > 1 && t.Path[0] == "#" && !l.knownNamer(t.Path[1:]) {
+			l.report(LintUnknownNamer, SeverityWarning, i,
+				"destination %s uses unknown namer /#/%s", t.Path, escapeLabel(t.Path[1]))
+		}
+	case Alt:
+		for _, branch := range t.Trees {
+			l.lintTree(i, dentry, branch)
+		}
+	case Union:
+		for _, w := range t.Trees {
+			if w.Weight == 0 {
+				l.report(LintZeroWeight, SeverityWarning, i,
+					"union branch %s has zero weight", showSimple(w.Tree))
+			}
+			l.lintTree(i, dentry, w.Tree)
+		}
+	}
+}
+
+// knownNamer reports whether path, relative to /#/, starts with the
+// prefix of a configured namer. Namer prefixes may have several labels.
+func (l *linter) knownNamer(path Path) bool {
+	for _, namer := range l.namers {
+		labels := strings.Split(strings.Trim(strings.TrimPrefix(namer, "/#/"), "/"), "/")
+		if len(labels) > len(path) {
+			continue
+		}
+		known := true
+		for i, label := range labels {
+			if path[i] != label {
+				known = false
+				break
+			}
+		}
+		if known {
+			return true
+		}
+	}
+	return false
+}
+
+// delegate rewrites path with dentry, which must match it, and then
+// delegates the result through the rest of the dtab. truncated reports
+// whether the tree was cut short at MaxDelegateNodes.
+func (l *linter) delegate(dentry *Dentry, path Path) (tree *DelegateTree, truncated bool) {
+	d := &delegator{dtab: l.dtab}
+	suffix := path[len(dentry.Prefix):]
+	tree = d.tree(path, dentry, appendSuffix(dentry.Destination, suffix), []string{path.String()})
+	return tree, d.truncated
+}
+
+// Covers reports whether pfx matches every path that other matches.
+func (pfx Prefix) Covers(other Prefix) bool {
+	if len(pfx) > len(other) {
+		return false
+	}
+	for i, elem := range pfx {
+		if !elem.Any && (other[i].Any || other[i].Label != elem.Label) {
+			return false
+		}
+	}
+	return true
+}
+
+// placeholderLabel stands in for labels that could be anything in the
+// paths used to simulate delegation during Lint.
+const placeholderLabel = "..."
+
+// prefixPath turns pfx into a representative path of the names it
+// matches: wildcards, and the rest of the name after the prefix, are
+// replaced by placeholderLabel.
+func prefixPath(pfx Prefix) Path {
+	path := make(Path, len(pfx), len(pfx)+1)
+	for i, elem := range pfx {
+		if elem.Any {
+			path[i] = placeholderLabel
+		} else {
+			path[i] = elem.Label
+		}
+	}
+	return append(path, placeholderLabel)
+}
+
+// dependsOnNamers reports whether tree has a leaf bound by a /#/ namer.
+func dependsOnNamers(tree NameTree) bool {
+	switch t := tree.(type) {
+	case Leaf:
+		return len(t.Path) > 0 && t.Path[0] == "#"
+	case Alt:
+		for _, branch := range t.Trees {
+			if dependsOnNamers(branch) {
+				return true
+			}
+		}
+	case Union:
+		for _, w := range t.Trees {
+			if dependsOnNamers(w.Tree) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func firstException(tree *DelegateTree) string {
+	if tree == nil {
+		return ""
+	}
+	if tree.Type == DelegateTypeException {
+		return tree.Message
+	}
+	children := append([]*DelegateTree{tree.Delegate}, tree.Alt...)
+	for _, w := range tree.Union {
+		children = append(children, w.Tree)
+	}
+	for _, child := range children {
+		if msg := firstException(child); msg != "" {
+			return msg
+		}
+	}
+	return ""
+}
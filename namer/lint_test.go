@@ -0,0 +1,67 @@
+package namer
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type linttest struct {
+	dtab     string
+	problems []string
+}
+
+var testlints = []linttest{
+	linttest{"/svc=>/#/io.l5d.fs;/svc/users=>/svc/people", nil},
+	linttest{"/svc=>/#/io.l5d.k8s/prod/http;/svc=>/#/io.l5d.fs", nil},
+	linttest{
+		"/svc=>/#/io.l5d.fs;/host=>/#/io.l5d.fs;/svc=>/#/io.l5d.fs",
+		[]string{"2:duplicate"},
+	},
+	linttest{
+		"/svc/users=>/#/io.l5d.fs;/svc=>/$/inet/127.1/4140",
+		[]string{"0:shadowed"},
+	},
+	linttest{"/svc/users=>/#/io.l5d.fs;/svc/*=>!", []string{"0:shadowed"}},
+	linttest{"/svc/*/users=>/#/io.l5d.fs;/svc/prod=>!", nil},
+	linttest{
+		"/svc=>/host;/host=>/svc",
+		[]string{"0:unresolvable", "1:unresolvable"},
+	},
+	linttest{"/svc=>/#/io.l5d.fs | /host;/host=>/svc", nil},
+	linttest{"/svc=>/#/io.l5d.fss", []string{"0:unknown-namer"}},
+	linttest{"/svc=>0 * /#/io.l5d.fs & /#/io.l5d.k8s", []string{"0:zero-weight"}},
+	linttest{"/svc/ => /#/io.l5d.fs", []string{"0:trailing-slash"}},
+	linttest{"/svc=>/svc/a | /svc/b", []string{"0:too-large"}},
+	linttest{"/svc=>/#/io.l5d.fs;/svc=>/svc/a | /svc/b", []string{"1:too-large"}},
+}
+
+func TestLint(t *testing.T) {
+	for _, test := range testlints {
+		dtab, err := ParseDtab(test.dtab)
+		if err != nil {
+			t.Fatalf("%s: unexpected parse error %s", test.dtab, err)
+		}
+		problems := []string{}
+		for _, problem := range Lint(dtab, LintOptions{}) {
+			problems = append(problems, fmt.Sprintf("%d:%s", problem.Index, problem.Check))
+		}
+		if len(problems) == 0 && len(test.problems) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(problems, test.problems) {
+			t.Errorf("%s: expected problems %v, got %v", test.dtab, test.problems, problems)
+		}
+	}
+}
+
+func TestLintNamers(t *testing.T) {
+	dtab, err := ParseDtab("/svc=>/#/k8s/prod/http;/host=>/#/k8s/staging")
+	if err != nil {
+		t.Fatal("unexpected parse error", err)
+	}
+	problems := Lint(dtab, LintOptions{Namers: []string{"/#/k8s/prod"}})
+	if len(problems) != 1 || problems[0].Index != 1 || problems[0].Check != LintUnknownNamer {
+		t.Errorf("expected an unknown namer in dentry 1, got %v", problems)
+	}
+}
@@ -0,0 +1,109 @@
+package namer
+
+// MergeHunk is a run of dentries in the result of MergeDtabs.
+type MergeHunk struct {
+	// Dtab holds the merged dentries of a hunk without conflict.
+	Dtab Dtab
+	// Conflict is set when both sides changed the same dentries of Base
+	// differently; Ours and Theirs hold their versions.
+	Conflict bool
+	Base     Dtab
+	Ours     Dtab
+	Theirs   Dtab
+}
+
+// MergeDtabs merges the changes made to base in ours and in theirs, the
+// way diff3 merges lines: runs of dentries changed on only one side are
+// taken from that side, and runs changed differently on both sides are
+// returned as conflicting hunks.
+func MergeDtabs(base, ours, theirs Dtab) []*MergeHunk {
+	baseStrs := dentryStrings(base)
+	ourStrs := dentryStrings(ours)
+	theirStrs := dentryStrings(theirs)
+
+	// matchOurs[i] and matchTheirs[i] are the indices matching base[i]
+	// on each side, or -1.
+	matchOurs := matchStrings(diffStrings(baseStrs, ourStrs), len(base))
+	matchTheirs := matchStrings(diffStrings(baseStrs, theirStrs), len(base))
+
+	hunks := []*MergeHunk{}
+	emit := func(dtab Dtab) {
+		if len(dtab) == 0 {
+			return
+		}
+		if n := len(hunks); n > 0 && !hunks[n-1].Conflict {
+			hunks[n-1].Dtab = append(hunks[n-1].Dtab, dtab...)
+			return
+		}
+		hunks = append(hunks, &MergeHunk{Dtab: append(Dtab{}, dtab...)})
+	}
+
+	b, o, t := 0, 0, 0
+	for {
+		// Find the next dentry of base that is unchanged on both sides.
+		k := b
+		for k < len(base) && (matchOurs[k] < 0 || matchTheirs[k] < 0) {
+			k++
+		}
+		oEnd, tEnd := len(ours), len(theirs)
+		if k < len(base) {
+			oEnd, tEnd = matchOurs[k], matchTheirs[k]
+		}
+
+		baseRun, ourRun, theirRun := base[b:k], ours[o:oEnd], theirs[t:tEnd]
+		switch {
+		case sameDentries(ourRun, baseRun):
+			emit(theirRun)
+		case sameDentries(theirRun, baseRun), sameDentries(ourRun, theirRun):
+			emit(ourRun)
+		default:
+			hunks = append(hunks, &MergeHunk{
+				Conflict: true,
+				Base:     baseRun,
+				Ours:     ourRun,
+				Theirs:   theirRun,
+			})
+		}
+
+		if k == len(base) {
+			return hunks
+		}
+		emit(base[k : k+1])
+		b, o, t = k+1, oEnd+1, tEnd+1
+	}
+}
+
+// HasConflicts reports whether any of hunks is a conflict.
+func HasConflicts(hunks []*MergeHunk) bool {
+	for _, h := range hunks {
+		if h.Conflict {
+			return true
+		}
+	}
+	return false
+}
+
+func matchStrings(script []strEdit, n int) []int {
+	match := make([]int, n)
+	for i := range match {
+		match[i] = -1
+	}
+	for _, e := range script {
+		if e.old >= 0 && e.new >= 0 {
+			match[e.old] = e.new
+		}
+	}
+	return match
+}
+
+func sameDentries(a, b Dtab) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].String() != b[i].String() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package namer
+
+import (
+	"testing"
+)
+
+type mergetest struct {
+	base, ours, theirs string
+	merged             string
+	conflict           bool
+}
+
+var testmerges = []mergetest{
+	mergetest{"/a=>/x;/b=>/y", "/a=>/x;/b=>/y", "/a=>/z;/b=>/y", "/a=>/z;/b=>/y;", false},
+	mergetest{"/a=>/x;/m=>/m;/b=>/y", "/a=>/x;/m=>/m;/b=>/w", "/a=>/z;/m=>/m;/b=>/y", "/a=>/z;/m=>/m;/b=>/w;", false},
+	mergetest{"/a=>/x;/b=>/y", "/a=>/x;/b=>/y;/c=>/v", "/b=>/y", "/b=>/y;/c=>/v;", false},
+	mergetest{"/a=>/x;/b=>/y", "/a=>/q;/b=>/y", "/a=>/q;/b=>/y", "/a=>/q;/b=>/y;", false},
+	mergetest{"/a=>/x;/b=>/y", "/a=>/q;/b=>/y", "/a=>/x;/b=>/y", "/a=>/q;/b=>/y;", false},
+	mergetest{"/a=>/x;/b=>/y", "/a=>/q;/b=>/y", "/a=>/r;/b=>/y", "", true},
+	mergetest{"", "/a=>/x", "/b=>/y", "", true},
+}
+
+func TestMergeDtabs(t *testing.T) {
+	for _, test := range testmerges {
+		hunks := MergeDtabs(mustParse(t, test.base), mustParse(t, test.ours), mustParse(t, test.theirs))
+		if HasConflicts(hunks) != test.conflict {
+			t.Errorf("%q, %q, %q: expected conflict %v", test.base, test.ours, test.theirs, test.conflict)
+			continue
+		}
+		if test.conflict {
+			continue
+		}
+		merged := Dtab{}
+		for _, h := range hunks {
+			merged = append(merged, h.Dtab...)
+		}
+		if merged.String() != test.merged {
+			t.Errorf("%q, %q, %q: expected '%s', got '%s'",
+				test.base, test.ours, test.theirs, test.merged, merged)
+		}
+	}
+}
+
+func TestMergeConflictHunk(t *testing.T) {
+	hunks := MergeDtabs(
+		mustParse(t, "/a=>/x;/b=>/y;/c=>/z"),
+		mustParse(t, "/a=>/x;/b=>/q;/c=>/z"),
+		mustParse(t, "/a=>/x;/b=>/r;/c=>/z"),
+	)
+	if len(hunks) != 3 || !hunks[1].Conflict {
+		t.Fatalf("expected a conflict between two resolved hunks, got %d hunks", len(hunks))
+	}
+	h := hunks[1]
+	if h.Base.String() != "/b=>/y;" || h.Ours.String() != "/b=>/q;" || h.Theirs.String() != "/b=>/r;" {
+		t.Errorf("unexpected conflict: base '%s', ours '%s', theirs '%s'", h.Base, h.Ours, h.Theirs)
+	}
+}
+
+func mustParse(t *testing.T, str string) Dtab {
+	dtab, err := ParseDtab(str)
+	if err != nil {
+		t.Fatalf("%q: unexpected parse error %s", str, err)
+	}
+	return dtab
+}
@@ -0,0 +1,225 @@
+package namertest
+
+import (
+	"context"
+
+	"github.com/linkerd/namerctl/namer"
+)
+
+// Delegate delegates path through the namespace's dtab and overlay, and
+// adds the addresses of the bound names to the leaves.
+func (c *Controller) Delegate(ctx context.Context, ns string, path namer.Path, overlay namer.Dtab) (*namer.DelegateTree, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.delegate(ns, path, overlay)
+}
+
+// delegate is Delegate with c.mu held.
+func (c *Controller) delegate(ns string, path namer.Path, overlay namer.Dtab) (*namer.DelegateTree, error) {
+	vd, err := c.get(ns)
+	if err != nil {
+		return nil, err
+	}
+	dtab := append(vd.Dtab, overlay...)
+	tree := dtab.Delegate(path)
+	c.addAddrs(tree)
+	return tree, nil
+}
+
+func (c *Controller) addAddrs(tree *namer.DelegateTree) {
+	if tree == nil {
+		return
+	}
+	if tree.Bound != nil {
+		tree.Bound.Addr = c.addr(tree.Bound.ID)
+	}
+	c.addAddrs(tree.Delegate)
+	for _, branch := range tree.Alt {
+		c.addAddrs(branch)
+	}
+	for _, w := range tree.Union {
+		c.addAddrs(w.Tree)
+	}
+}
+
+func (c *Controller) Bind(ctx context.Context, ns string, path namer.Path, overlay namer.Dtab) (*namer.BoundTree, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bind(ns, path, overlay)
+}
+
+func (c *Controller) WatchBind(ctx context.Context, ns string, path namer.Path, overlay namer.Dtab) (<-chan *namer.BoundTree, error) {
+	trees := make(chan *namer.BoundTree)
+	err := c.watch(ctx,
+		func() (interface{}, error) { return c.bind(ns, path, overlay) },
+		func(value interface{}) bool {
+			select {
+			case trees <- value.(*namer.BoundTree):
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		},
+		func() { close(trees) })
+	if err != nil {
+		return nil, err
+	}
+	return trees, nil
+}
+
+// bind is Bind with c.mu held.
+func (c *Controller) bind(ns string, path namer.Path, overlay namer.Dtab) (*namer.BoundTree, error) {
+	tree, err := c.delegate(ns, path, overlay)
+	if err != nil {
+		return nil, err
+	}
+	return boundTree(tree.Result()), nil
+}
+
+func boundTree(tree namer.NameTree) *namer.BoundTree {
+	switch t := tree.(type) {
+	case namer.Leaf:
+		return &namer.BoundTree{
+			Type:  namer.DelegateTypeLeaf,
+			Bound: &namer.BoundName{ID: t.Path, Path: namer.Path{}},
+		}
+	case namer.Alt:
+		alt := &namer.BoundTree{Type: namer.DelegateTypeAlt}
+		for _, branch := range t.Trees {
+			alt.Alt = append(alt.Alt, boundTree(branch))
+		}
+		return alt
+	case namer.Union:
+		union := &namer.BoundTree{Type: namer.DelegateTypeUnion}
+		for _, w := range t.Trees {
+			union.Union = append(union.Union, &namer.WeightedBoundTree{Weight: w.Weight, Tree: boundTree(w.Tree)})
+		}
+		return union
+	case namer.Fail:
+		return &namer.BoundTree{Type: namer.DelegateTypeFail}
+	case namer.Empty:
+		return &namer.BoundTree{Type: namer.DelegateTypeEmpty}
+	default:
+		return &namer.BoundTree{Type: namer.DelegateTypeNeg}
+	}
+}
+
+func (c *Controller) Addr(ctx context.Context, ns string, id namer.Path) (*namer.Addr, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.dtabs[ns]; !ok {
+		return nil, namer.ErrNotFound
+	}
+	return c.addr(id), nil
+}
+
+func (c *Controller) WatchAddr(ctx context.Context, ns string, id namer.Path) (<-chan *namer.Addr, error) {
+	return c.watchAddr(ctx, func() (interface{}, error) {
+		if _, ok := c.dtabs[ns]; !ok {
+			return nil, namer.ErrNotFound
+		}
+		return c.addr(id), nil
+	})
+}
+
+func (c *Controller) watchAddr(ctx context.Context, eval func() (interface{}, error)) (<-chan *namer.Addr, error) {
+	addrs := make(chan *namer.Addr)
+	err := c.watch(ctx, eval,
+		func(value interface{}) bool {
+			select {
+			case addrs <- value.(*namer.Addr):
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		},
+		func() { close(addrs) })
+	if err != nil {
+		return nil, err
+	}
+	return addrs, nil
+}
+
+// addr returns the addresses given to SetAddr for id, or a "neg" Addr.
+// c.mu must be held.
+func (c *Controller) addr(id namer.Path) *namer.Addr {
+	addr, ok := c.addrs[id.String()]
+	if !ok {
+		return &namer.Addr{Type: namer.AddrTypeNeg}
+	}
+	return copyAddr(addr)
+}
+
+func (c *Controller) Resolve(ctx context.Context, ns string, path namer.Path, overlay namer.Dtab) (*namer.Addr, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resolve(ns, path, overlay)
+}
+
+func (c *Controller) WatchResolve(ctx context.Context, ns string, path namer.Path, overlay namer.Dtab) (<-chan *namer.Addr, error) {
+	return c.watchAddr(ctx, func() (interface{}, error) {
+		return c.resolve(ns, path, overlay)
+	})
+}
+
+// resolve is Resolve with c.mu held. The addresses of the names in a
+// union carry the weight of their branch, as Finagle records it.
+func (c *Controller) resolve(ns string, path namer.Path, overlay namer.Dtab) (*namer.Addr, error) {
+	tree, err := c.delegate(ns, path, overlay)
+	if err != nil {
+		return nil, err
+	}
+	resolved := &namer.Addr{Type: namer.AddrTypeNeg}
+	c.collectAddrs(tree.Result(), namer.DefaultWeight, resolved)
+	return resolved, nil
+}
+
+func (c *Controller) collectAddrs(tree namer.NameTree, weight float64, resolved *namer.Addr) {
+	switch t := tree.(type) {
+	case namer.Leaf:
+		addr := c.addr(t.Path)
+		switch addr.Type {
+		case namer.AddrTypeBound:
+			for _, address := range addr.Addrs {
+				if weight != namer.DefaultWeight {
+					if address.Meta == nil {
+						address.Meta = map[string]interface{}{}
+					}
+					address.Meta[namer.AddressWeightKey] = weight * address.Weight()
+				}
+				resolved.Addrs = append(resolved.Addrs, address)
+			}
+			resolved.Type = namer.AddrTypeBound
+			resolved.Cause = ""
+		case namer.AddrTypeFailed, namer.AddrTypePending:
+			if resolved.Type != namer.AddrTypeBound {
+				resolved.Type = addr.Type
+				resolved.Cause = addr.Cause
+			}
+		}
+	case namer.Alt:
+		if len(t.Trees) > 0 {
+			c.collectAddrs(t.Trees[0], weight, resolved)
+		}
+	case namer.Union:
+		for _, w := range t.Trees {
+			c.collectAddrs(w.Tree, weight*w.Weight, resolved)
+		}
+	case namer.Fail:
+		if resolved.Type == namer.AddrTypeNeg {
+			resolved.Type = namer.AddrTypeFailed
+		}
+	}
+}
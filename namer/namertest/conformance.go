@@ -0,0 +1,280 @@
+package namertest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/linkerd/namerctl/namer"
+)
+
+// conformanceTimeout bounds how long the suite waits for a watch.
+const conformanceTimeout = 5 * time.Second
+
+type conformanceTest struct {
+	name string
+	run  func(t *testing.T, ctl namer.Controller, ns string)
+}
+
+var conformanceTests = []conformanceTest{
+	{"Create", testCreate},
+	{"CreateExisting", testCreateExisting},
+	{"CreateInvalid", testCreateInvalid},
+	{"CreateJSON", testCreateJSON},
+	{"NotFound", testNotFound},
+	{"Update", testUpdate},
+	{"UpdateJSONVersion", testUpdateJSONVersion},
+	{"Delete", testDelete},
+	{"Canceled", testCanceled},
+	{"Watch", testWatch},
+	{"WatchNotFound", testWatchNotFound},
+	{"WatchList", testWatchList},
+}
+
+// Conformance checks that the controllers newController returns behave
+// like namerd. Each test gets a new controller and works on its own
+// namespace, named "namertest-" and a unique suffix, which it deletes
+// when it is done, so that the suite can also run against a real namerd.
+func Conformance(t *testing.T, newController func() namer.Controller) {
+	for _, test := range conformanceTests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			ctl := newController()
+			ns := fmt.Sprintf("namertest-%s-%d", test.name, time.Now().UnixNano())
+			defer ctl.Delete(ns)
+			test.run(t, ctl, ns)
+		})
+	}
+}
+
+func mustCreate(t *testing.T, ctl namer.Controller, ns, dtabstr string) namer.Version {
+	version, err := ctl.Create(ns, dtabstr)
+	if err != nil {
+		t.Fatalf("creating %s: %s", ns, err)
+	}
+	return version
+}
+
+// expectDtab checks that the namespace ns has version, unless it is
+// empty, and the dtab dtabstr.
+func expectDtab(t *testing.T, ctl namer.Controller, ns string, version namer.Version, dtabstr string) {
+	vd, err := ctl.Get(ns)
+	if err != nil {
+		t.Fatalf("getting %s: %s", ns, err)
+	}
+	if version != "" && vd.Version != version {
+		t.Errorf("expected version %q, got %q", version, vd.Version)
+	}
+	if vd.Dtab.String() != dtabstr {
+		t.Errorf("expected dtab %q, got %q", dtabstr, vd.Dtab.String())
+	}
+}
+
+func expectError(t *testing.T, what string, expected, err error) {
+	if err != expected {
+		t.Errorf("%s: expected %v, got %v", what, expected, err)
+	}
+}
+
+func listed(t *testing.T, ctl namer.Controller, ns string) bool {
+	names, err := ctl.List()
+	if err != nil {
+		t.Fatalf("listing: %s", err)
+	}
+	for _, name := range names {
+		if name == ns {
+			return true
+		}
+	}
+	return false
+}
+
+func testCreate(t *testing.T, ctl namer.Controller, ns string) {
+	version := mustCreate(t, ctl, ns, "/svc => /#/io.l5d.fs;")
+	if version == "" {
+		t.Error("expected a version")
+	}
+	expectDtab(t, ctl, ns, version, "/svc=>/#/io.l5d.fs;")
+	if !listed(t, ctl, ns) {
+		t.Errorf("expected %s to be listed", ns)
+	}
+}
+
+func testCreateExisting(t *testing.T, ctl namer.Controller, ns string) {
+	version := mustCreate(t, ctl, ns, "/a=>/b")
+	_, err := ctl.Create(ns, "/a=>/c")
+	expectError(t, "creating again", namer.ErrAlreadyExists, err)
+	expectDtab(t, ctl, ns, version, "/a=>/b;")
+}
+
+// invalidDtabs are rejected by namerd, in text and in JSON.
+var invalidDtabs = []string{
+	"/a=>",
+	"/a/=>/b",
+	`{"dtab":[{"prefix":"/a/","dst":"/b"}]}`,
+}
+
+func testCreateInvalid(t *testing.T, ctl namer.Controller, ns string) {
+	for _, dtabstr := range invalidDtabs {
+		_, err := ctl.Create(ns, dtabstr)
+		if _, ok := err.(*namer.ErrBadRequest); !ok {
+			t.Errorf("%s: expected *namer.ErrBadRequest, got %#v", dtabstr, err)
+		}
+	}
+	_, err := ctl.Get(ns)
+	expectError(t, "getting", namer.ErrNotFound, err)
+}
+
+func testCreateJSON(t *testing.T, ctl namer.Controller, ns string) {
+	version := mustCreate(t, ctl, ns, `{"dtab":[{"prefix":"/a","dst":"/b | /c"}]}`)
+	expectDtab(t, ctl, ns, version, "/a=>/b | /c;")
+}
+
+func testNotFound(t *testing.T, ctl namer.Controller, ns string) {
+	_, err := ctl.Get(ns)
+	expectError(t, "getting", namer.ErrNotFound, err)
+	_, err = ctl.Update(ns, "/a=>/b", "")
+	expectError(t, "updating", namer.ErrNotFound, err)
+	err = ctl.Delete(ns)
+	expectError(t, "deleting", namer.ErrNotFound, err)
+}
+
+func testUpdate(t *testing.T, ctl namer.Controller, ns string) {
+	v1 := mustCreate(t, ctl, ns, "/a=>/b")
+	v2, err := ctl.Update(ns, "/a=>/c", v1)
+	if err != nil {
+		t.Fatalf("updating: %s", err)
+	}
+	if v2 == "" || v2 == v1 {
+		t.Errorf("expected a new version, got %q after %q", v2, v1)
+	}
+	expectDtab(t, ctl, ns, v2, "/a=>/c;")
+
+	_, err = ctl.Update(ns, "/a=>/d", v1)
+	expectError(t, "updating an old version", namer.ErrVersionConflict, err)
+	expectDtab(t, ctl, ns, v2, "/a=>/c;")
+
+	v3, err := ctl.Update(ns, "/a=>/e", "")
+	if err != nil {
+		t.Fatalf("updating unconditionally: %s", err)
+	}
+	expectDtab(t, ctl, ns, v3, "/a=>/e;")
+}
+
+func testUpdateJSONVersion(t *testing.T, ctl namer.Controller, ns string) {
+	v1 := mustCreate(t, ctl, ns, "/a=>/b")
+	v2, err := ctl.Update(ns, fmt.Sprintf(`{"version":%q,"dtab":[{"prefix":"/a","dst":"/c"}]}`, v1), "")
+	if err != nil {
+		t.Fatalf("updating: %s", err)
+	}
+	_, err = ctl.Update(ns, fmt.Sprintf(`{"version":%q,"dtab":[{"prefix":"/a","dst":"/d"}]}`, v1), "")
+	expectError(t, "updating an old version", namer.ErrVersionConflict, err)
+	expectDtab(t, ctl, ns, v2, "/a=>/c;")
+}
+
+func testDelete(t *testing.T, ctl namer.Controller, ns string) {
+	mustCreate(t, ctl, ns, "/a=>/b")
+	if err := ctl.Delete(ns); err != nil {
+		t.Fatalf("deleting: %s", err)
+	}
+	_, err := ctl.Get(ns)
+	expectError(t, "getting", namer.ErrNotFound, err)
+	if listed(t, ctl, ns) {
+		t.Errorf("expected %s not to be listed", ns)
+	}
+}
+
+func testCanceled(t *testing.T, ctl namer.Controller, ns string) {
+	mustCreate(t, ctl, ns, "/a=>/b")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := namer.GetContext(ctx, ctl, ns)
+	expectError(t, "getting", context.Canceled, err)
+	_, err = namer.UpdateContext(ctx, ctl, ns, "/a=>/c", "")
+	expectError(t, "updating", context.Canceled, err)
+	expectDtab(t, ctl, ns, "", "/a=>/b;")
+}
+
+// watcher returns ctl as a Watcher, skipping the test if it is not one.
+func watcher(t *testing.T, ctl namer.Controller) namer.Watcher {
+	watcher, ok := ctl.(namer.Watcher)
+	if !ok {
+		t.Skip("the controller cannot watch dtabs")
+	}
+	return watcher
+}
+
+func testWatch(t *testing.T, ctl namer.Controller, ns string) {
+	watcher := watcher(t, ctl)
+	v1 := mustCreate(t, ctl, ns, "/a=>/b")
+	ctx, cancel := context.WithTimeout(context.Background(), conformanceTimeout)
+	defer cancel()
+	updates, err := watcher.Watch(ctx, ns)
+	if err != nil {
+		t.Fatalf("watching: %s", err)
+	}
+
+	expectUpdate := func(version namer.Version, dtabstr string) {
+		vd, ok := <-updates
+		if !ok {
+			t.Fatalf("expected version %q, but the watch ended", version)
+		}
+		if vd.Version != version || vd.Dtab.String() != dtabstr {
+			t.Fatalf("expected %q %s, got %q %s", version, dtabstr, vd.Version, vd.Dtab)
+		}
+	}
+	expectUpdate(v1, "/a=>/b;")
+	v2, err := ctl.Update(ns, "/a=>/c", v1)
+	if err != nil {
+		t.Fatalf("updating: %s", err)
+	}
+	expectUpdate(v2, "/a=>/c;")
+
+	if err := ctl.Delete(ns); err != nil {
+		t.Fatalf("deleting: %s", err)
+	}
+	if _, ok := <-updates; ok {
+		t.Error("expected the watch to end when the dtab was deleted")
+	}
+	if ctx.Err() != nil {
+		t.Error("the watch did not end in time")
+	}
+}
+
+func testWatchNotFound(t *testing.T, ctl namer.Controller, ns string) {
+	_, err := watcher(t, ctl).Watch(context.Background(), ns)
+	expectError(t, "watching", namer.ErrNotFound, err)
+}
+
+func testWatchList(t *testing.T, ctl namer.Controller, ns string) {
+	ctx, cancel := context.WithTimeout(context.Background(), conformanceTimeout)
+	defer cancel()
+	watcher, ok := ctl.(namer.ListWatcher)
+	if !ok {
+		t.Skip("the controller cannot watch the list of dtabs")
+	}
+	events, err := watcher.WatchList(ctx)
+	if err != nil {
+		t.Fatalf("watching: %s", err)
+	}
+
+	// Other namespaces may come and go on a shared namerd.
+	expectEvent := func(typ namer.EventType) {
+		for event := range events {
+			if event.Name == ns {
+				if event.Type != typ {
+					t.Fatalf("expected %s %s, got %s", typ, ns, event.Type)
+				}
+				return
+			}
+		}
+		t.Fatalf("expected %s %s, but the watch ended", typ, ns)
+	}
+	mustCreate(t, ctl, ns, "/a=>/b")
+	expectEvent(namer.Added)
+	if err := ctl.Delete(ns); err != nil {
+		t.Fatalf("deleting: %s", err)
+	}
+	expectEvent(namer.Removed)
+}
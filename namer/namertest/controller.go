@@ -0,0 +1,335 @@
+// Package namertest provides an in-memory namer.Controller and an HTTP
+// handler serving namerd's API from any Controller, for tests of code
+// that talks to namerd, and a suite that checks that a Controller behaves
+// like namerd.
+package namertest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/linkerd/namerctl/namer"
+)
+
+type (
+	// Controller is a namer.Controller that keeps its dtabs in memory,
+	// with the semantics of namerd's API: every change gets a new
+	// version, conditional updates fail with namer.ErrVersionConflict
+	// when the version does not match, and watches are notified of
+	// every change. It is safe for concurrent use.
+	//
+	// Names are bound the way namerctl's offline delegator binds them:
+	// paths under /# and /$ are bound names, and their addresses are
+	// those given to SetAddr.
+	Controller struct {
+		mu      sync.Mutex
+		dtabs   map[string]*entry
+		addrs   map[string]*namer.Addr
+		version uint64
+		// changed is closed, and replaced, whenever anything changes.
+		changed chan struct{}
+	}
+
+	entry struct {
+		version namer.Version
+		// The dtab is kept as text so that callers cannot modify it.
+		dtab string
+	}
+)
+
+// NewController returns a Controller without dtabs.
+func NewController() *Controller {
+	return &Controller{
+		dtabs:   map[string]*entry{},
+		addrs:   map[string]*namer.Addr{},
+		changed: make(chan struct{}),
+	}
+}
+
+// SetAddr sets the addresses of the bound name id, or removes them if
+// addr is nil.
+func (c *Controller) SetAddr(id namer.Path, addr *namer.Addr) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if addr == nil {
+		delete(c.addrs, id.String())
+	} else {
+		c.addrs[id.String()] = copyAddr(addr)
+	}
+	c.notify()
+}
+
+// notify wakes the watches. c.mu must be held.
+func (c *Controller) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// nextVersion returns a version that was never returned before, so that
+// a dtab that is deleted and created again gets a new version too. c.mu
+// must be held.
+func (c *Controller) nextVersion() namer.Version {
+	c.version++
+	return namer.Version(strconv.FormatUint(c.version, 10))
+}
+
+func (c *Controller) List() ([]string, error) {
+	return c.ListContext(context.Background())
+}
+
+func (c *Controller) ListContext(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.names(), nil
+}
+
+// names returns the names of the dtabs, sorted. c.mu must be held.
+func (c *Controller) names() []string {
+	names := make([]string, 0, len(c.dtabs))
+	for name := range c.dtabs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *Controller) Get(name string) (*namer.VersionedDtab, error) {
+	return c.GetContext(context.Background(), name)
+}
+
+func (c *Controller) GetContext(ctx context.Context, name string) (*namer.VersionedDtab, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.get(name)
+}
+
+// get returns the named dtab. c.mu must be held.
+func (c *Controller) get(name string) (*namer.VersionedDtab, error) {
+	e, ok := c.dtabs[name]
+	if !ok {
+		return nil, namer.ErrNotFound
+	}
+	dtab, err := namer.ParseDtab(e.dtab)
+	if err != nil {
+		return nil, err
+	}
+	return &namer.VersionedDtab{Version: e.version, Dtab: dtab}, nil
+}
+
+func (c *Controller) Create(name, dtabstr string) (namer.Version, error) {
+	return c.CreateContext(context.Background(), name, dtabstr)
+}
+
+func (c *Controller) CreateContext(ctx context.Context, name, dtabstr string) (namer.Version, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	dtab, _, err := parseDtab(dtabstr)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.dtabs[name]; ok {
+		return "", namer.ErrAlreadyExists
+	}
+	e := &entry{version: c.nextVersion(), dtab: dtab.String()}
+	c.dtabs[name] = e
+	c.notify()
+	return e.version, nil
+}
+
+func (c *Controller) Delete(name string) error {
+	return c.DeleteContext(context.Background(), name)
+}
+
+func (c *Controller) DeleteContext(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.dtabs[name]; !ok {
+		return namer.ErrNotFound
+	}
+	delete(c.dtabs, name)
+	c.notify()
+	return nil
+}
+
+func (c *Controller) Update(name, dtabstr string, version namer.Version) (namer.Version, error) {
+	return c.UpdateContext(context.Background(), name, dtabstr, version)
+}
+
+func (c *Controller) UpdateContext(ctx context.Context, name, dtabstr string, version namer.Version) (namer.Version, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	dtab, jsonVersion, err := parseDtab(dtabstr)
+	if err != nil {
+		return "", err
+	}
+	if jsonVersion != "" {
+		version = jsonVersion
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.dtabs[name]
+	if !ok {
+		return "", namer.ErrNotFound
+	}
+	if version != "" && version != e.version {
+		return "", namer.ErrVersionConflict
+	}
+	e.version = c.nextVersion()
+	e.dtab = dtab.String()
+	c.notify()
+	return e.version, nil
+}
+
+// parseDtab parses dtabstr the way namerd would receive it from
+// namer.Controller: as namerd's JSON representation, with an optional
+// version, if it starts with '{' or '[', and as text otherwise. Like
+// namerd, it rejects prefixes that end with a '/', and reports invalid
+// dtabs as a *namer.ErrBadRequest.
+func parseDtab(dtabstr string) (namer.Dtab, namer.Version, error) {
+	if len(dtabstr) > 0 && (dtabstr[0] == '{' || dtabstr[0] == '[') {
+		var vdtab namer.VersionedDtab
+		if err := json.Unmarshal([]byte(dtabstr), &vdtab); err != nil {
+			return nil, "", &namer.ErrBadRequest{Message: err.Error()}
+		}
+		for _, dentry := range vdtab.Dtab {
+			if dentry.Prefix.TrailingSlash() {
+				return nil, "", &namer.ErrBadRequest{
+					Message: fmt.Sprintf("prefix %s must not end with '/'", dentry.Prefix),
+				}
+			}
+		}
+		return vdtab.Dtab, vdtab.Version, nil
+	}
+	dtab, err := namer.ValidateDtabFile("", dtabstr)
+	if err != nil {
+		return nil, "", &namer.ErrBadRequest{Message: err.Error()}
+	}
+	return dtab, "", nil
+}
+
+// Watch streams the named dtab until ctx is done or it is deleted.
+func (c *Controller) Watch(ctx context.Context, name string) (<-chan *namer.VersionedDtab, error) {
+	updates := make(chan *namer.VersionedDtab)
+	err := c.watch(ctx,
+		func() (interface{}, error) { return c.get(name) },
+		func(value interface{}) bool {
+			select {
+			case updates <- value.(*namer.VersionedDtab):
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		},
+		func() { close(updates) })
+	if err != nil {
+		return nil, err
+	}
+	return updates, nil
+}
+
+// WatchList streams events for the dtabs that exist and then for those
+// created or deleted, until ctx is done. Removals are reported before
+// additions, each sorted by name.
+func (c *Controller) WatchList(ctx context.Context) (<-chan *namer.NamespaceEvent, error) {
+	events := make(chan *namer.NamespaceEvent)
+	known := map[string]bool{}
+	err := c.watch(ctx,
+		func() (interface{}, error) { return c.names(), nil },
+		func(value interface{}) bool {
+			for _, event := range namer.NamespaceEvents(known, value.([]string)) {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return false
+				}
+			}
+			return true
+		},
+		func() { close(events) })
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// watch evaluates eval with c.mu held, and then again each time the
+// controller changes, passing each value that differs from the previous
+// one to send, in a new goroutine that calls done once the watch ends.
+// The watch ends when ctx is done, eval fails or send returns false. The
+// first evaluation happens before watch returns, so that its error is
+// returned.
+func (c *Controller) watch(ctx context.Context, eval func() (interface{}, error), send func(interface{}) bool, done func()) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	value, err := eval()
+	changed := c.changed
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer done()
+		var last []byte
+		for {
+			current, err := json.Marshal(value)
+			if err != nil {
+				return
+			}
+			if !bytes.Equal(current, last) {
+				last = current
+				if !send(value) {
+					return
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-changed:
+			}
+			c.mu.Lock()
+			value, err = eval()
+			changed = c.changed
+			c.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func copyAddr(addr *namer.Addr) *namer.Addr {
+	bytes, err := json.Marshal(addr)
+	if err != nil {
+		panic(err)
+	}
+	copied := &namer.Addr{}
+	if err := json.Unmarshal(bytes, copied); err != nil {
+		panic(err)
+	}
+	return copied
+}
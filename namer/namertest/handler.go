@@ -0,0 +1,325 @@
+package namertest
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/linkerd/namerctl/namer"
+)
+
+// apiPrefix is the path under which namerd serves its HTTP API.
+const apiPrefix = "/api/1/"
+
+type handler struct {
+	ctl namer.Controller
+}
+
+// NewHandler returns a handler that serves namerd's HTTP API from ctl:
+// the dtabs endpoints, with their versions as ETags, and the bind, addr,
+// resolve and delegate endpoints. Requests with watch=true are streamed
+// as a sequence of JSON values. Endpoints whose optional interface ctl
+// does not implement respond with 501 Not Implemented.
+func NewHandler(ctl namer.Controller) http.Handler {
+	return &handler{ctl: ctl}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, apiPrefix) {
+		http.NotFound(w, r)
+		return
+	}
+	endpoint := strings.SplitN(strings.TrimPrefix(r.URL.Path, apiPrefix), "/", 2)
+	name := ""
+	if len(endpoint) == 2 {
+		name = strings.TrimSuffix(endpoint[1], "/")
+	}
+
+	switch endpoint[0] {
+	case "dtabs":
+		if name == "" {
+			h.serveList(w, r)
+		} else {
+			h.serveDtab(w, r, name)
+		}
+	case "bind", "addr", "resolve", "delegate":
+		if name == "" {
+			http.NotFound(w, r)
+			return
+		}
+		h.serveName(w, r, endpoint[0], name)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *handler) serveList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, "")
+		return
+	}
+	if !isWatch(r) {
+		names, err := namer.ListContext(r.Context(), h.ctl)
+		respond(w, names, err)
+		return
+	}
+
+	watcher, ok := h.ctl.(namer.ListWatcher)
+	if !ok {
+		respond(w, nil, &namer.ErrUnsupported{Operation: "watching the list of dtabs"})
+		return
+	}
+	events, err := watcher.WatchList(r.Context())
+	if err != nil {
+		respond(w, nil, err)
+		return
+	}
+	names, err := namer.ListContext(r.Context(), h.ctl)
+	if err != nil {
+		respond(w, nil, err)
+		return
+	}
+	// Like namerd, send the whole list each time it changes.
+	current := map[string]bool{}
+	for _, name := range names {
+		current[name] = true
+	}
+	first := true
+	stream(w, func() (interface{}, bool) {
+		if first {
+			first = false
+			return names, true
+		}
+		for event := range events {
+			if current[event.Name] == (event.Type == namer.Added) {
+				continue
+			}
+			current[event.Name] = event.Type == namer.Added
+			names = []string{}
+			for name, ok := range current {
+				if ok {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+			return names, true
+		}
+		return nil, false
+	})
+}
+
+func (h *handler) serveDtab(w http.ResponseWriter, r *http.Request, name string) {
+	ctx := r.Context()
+	switch r.Method {
+	case "GET":
+		if isWatch(r) {
+			watcher, ok := h.ctl.(namer.Watcher)
+			if !ok {
+				respond(w, nil, &namer.ErrUnsupported{Operation: "watching dtabs"})
+				return
+			}
+			updates, err := watcher.Watch(ctx, name)
+			if err != nil {
+				respond(w, nil, err)
+				return
+			}
+			stream(w, recv(updates))
+			return
+		}
+		vd, err := namer.GetContext(ctx, h.ctl, name)
+		if err != nil {
+			respond(w, nil, err)
+			return
+		}
+		w.Header().Set("ETag", string(vd.Version))
+		respond(w, vd.Dtab, nil)
+
+	case "POST", "PUT":
+		dtabstr, err := readDtab(r)
+		if err != nil {
+			respond(w, nil, err)
+			return
+		}
+		var version namer.Version
+		if r.Method == "POST" {
+			version, err = namer.CreateContext(ctx, h.ctl, name, dtabstr)
+		} else {
+			version, err = namer.UpdateContext(ctx, h.ctl, name, dtabstr, namer.Version(r.Header.Get("If-Match")))
+		}
+		if err != nil {
+			respond(w, nil, err)
+			return
+		}
+		w.Header().Set("ETag", string(version))
+		w.WriteHeader(http.StatusNoContent)
+
+	case "DELETE":
+		if err := namer.DeleteContext(ctx, h.ctl, name); err != nil {
+			respond(w, nil, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "")
+	}
+}
+
+// readDtab reads the dtab in the body of r as text, whether it was sent
+// as text or as namerd's JSON.
+func readDtab(r *http.Request) (string, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return string(body), nil
+	}
+	var dtab namer.Dtab
+	if err := json.Unmarshal(body, &dtab); err != nil {
+		return "", &namer.ErrBadRequest{Message: err.Error()}
+	}
+	return dtab.String(), nil
+}
+
+// serveName serves the bind, addr, resolve and delegate endpoints of the
+// namespace ns.
+func (h *handler) serveName(w http.ResponseWriter, r *http.Request, endpoint, ns string) {
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, "")
+		return
+	}
+	query := r.URL.Query()
+	path, err := namer.ParsePath(query.Get("path"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var overlay namer.Dtab
+	if dtab := query.Get("dtab"); dtab != "" {
+		if overlay, err = namer.ParseDtab(dtab); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	ctx := r.Context()
+	var value, updates interface{}
+	// err is set to ErrUnsupported unless ctl implements the interface
+	// of endpoint.
+	err = &namer.ErrUnsupported{Operation: endpoint}
+	switch endpoint {
+	case "delegate":
+		if delegator, ok := h.ctl.(namer.Delegator); ok {
+			value, err = delegator.Delegate(ctx, ns, path, overlay)
+		}
+	case "bind":
+		if binder, ok := h.ctl.(namer.Binder); ok && isWatch(r) {
+			updates, err = binder.WatchBind(ctx, ns, path, overlay)
+		} else if ok {
+			value, err = binder.Bind(ctx, ns, path, overlay)
+		}
+	case "addr":
+		if addresser, ok := h.ctl.(namer.Addresser); ok && isWatch(r) {
+			updates, err = addresser.WatchAddr(ctx, ns, path)
+		} else if ok {
+			value, err = addresser.Addr(ctx, ns, path)
+		}
+	case "resolve":
+		if resolver, ok := h.ctl.(namer.Resolver); ok && isWatch(r) {
+			updates, err = resolver.WatchResolve(ctx, ns, path, overlay)
+		} else if ok {
+			value, err = resolver.Resolve(ctx, ns, path, overlay)
+		}
+	}
+	if err != nil || updates == nil {
+		respond(w, value, err)
+		return
+	}
+	stream(w, recv(updates))
+}
+
+func isWatch(r *http.Request) bool {
+	return r.URL.Query().Get("watch") == "true"
+}
+
+// recv returns a function that receives the values of the channel
+// updates until it is closed.
+func recv(updates interface{}) func() (interface{}, bool) {
+	ch := reflect.ValueOf(updates)
+	return func() (interface{}, bool) {
+		value, ok := ch.Recv()
+		if !ok {
+			return nil, false
+		}
+		return value.Interface(), true
+	}
+}
+
+// stream writes each value next returns as JSON, flushing it to the
+// client, until next reports that there are no more values.
+func stream(w http.ResponseWriter, next func() (interface{}, bool)) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	for {
+		value, ok := next()
+		if !ok {
+			return
+		}
+		if err := enc.Encode(value); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// respond writes value as JSON, or the response namerd sends for err.
+func respond(w http.ResponseWriter, value interface{}, err error) {
+	if err != nil {
+		if e, ok := err.(*namer.ErrBadRequest); ok {
+			writeError(w, http.StatusBadRequest, e.Message)
+			return
+		}
+		if _, ok := err.(*namer.ErrUnsupported); ok {
+			writeError(w, http.StatusNotImplemented, err.Error())
+			return
+		}
+		switch err {
+		case namer.ErrNotFound:
+			writeError(w, http.StatusNotFound, "")
+		case namer.ErrAlreadyExists:
+			writeError(w, http.StatusConflict, "")
+		case namer.ErrVersionConflict:
+			writeError(w, http.StatusPreconditionFailed, "")
+		case context.Canceled, context.DeadlineExceeded:
+			// The client is gone.
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bytes)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(status)
+	if msg != "" {
+		w.Write([]byte(msg + "\n"))
+	}
+}
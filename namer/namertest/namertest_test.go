@@ -0,0 +1,180 @@
+package namertest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linkerd/namerctl/namer"
+)
+
+func TestController(t *testing.T) {
+	Conformance(t, func() namer.Controller {
+		return NewController()
+	})
+}
+
+// The HTTP controller checks the syntax of JSON dtabs before sending
+// them, so the fake is checked for it on its own.
+func TestControllerInvalidJSON(t *testing.T) {
+	ctl := NewController()
+	if _, err := ctl.Create("ns", `{"dtab":[`); err == nil {
+		t.Error("expected an error")
+	} else if _, ok := err.(*namer.ErrBadRequest); !ok {
+		t.Errorf("expected *namer.ErrBadRequest, got %#v", err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	server := httptest.NewServer(NewHandler(NewController()))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	Conformance(t, func() namer.Controller {
+		return namer.NewHttpController(u, &http.Client{Timeout: time.Second},
+			namer.WithRetryPolicy(namer.RetryPolicy{InitialBackoff: 10 * time.Millisecond}))
+	})
+}
+
+// minimalController hides the optional interfaces of the controller it
+// embeds.
+type minimalController struct {
+	namer.Controller
+}
+
+func TestMinimalController(t *testing.T) {
+	Conformance(t, func() namer.Controller {
+		return minimalController{NewController()}
+	})
+}
+
+func TestHandlerUnsupported(t *testing.T) {
+	server := httptest.NewServer(NewHandler(minimalController{NewController()}))
+	defer server.Close()
+	for _, endpoint := range []string{"dtabs?watch=true", "dtabs/default?watch=true", "bind/default?path=/svc",
+		"addr/default?path=/svc", "resolve/default?path=/svc", "delegate/default?path=/svc"} {
+		rsp, err := http.Get(server.URL + apiPrefix + endpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode != http.StatusNotImplemented {
+			t.Errorf("%s: expected status %d, got %d", endpoint, http.StatusNotImplemented, rsp.StatusCode)
+		}
+	}
+}
+
+// TestNamerd runs the suite against the namerd at $NAMERTEST_NAMERD_URL,
+// to check that the fake still behaves like namerd.
+func TestNamerd(t *testing.T) {
+	baseURL := os.Getenv("NAMERTEST_NAMERD_URL")
+	if baseURL == "" {
+		t.Skip("NAMERTEST_NAMERD_URL is not set")
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Conformance(t, func() namer.Controller {
+		return namer.NewHttpController(u, &http.Client{Timeout: 10 * time.Second})
+	})
+}
+
+type resolvetest struct {
+	dtab    string
+	path    string
+	overlay string
+	bound   string
+	addrs   []string
+}
+
+var resolvetests = []resolvetest{
+	resolvetest{"/svc=>/#/io.l5d.fs", "/svc/users", "", "/#/io.l5d.fs/users", []string{"10.0.0.1:80"}},
+	resolvetest{"/svc=>/#/io.l5d.fs", "/svc/users", "/svc=>/#/io.l5d.k8s", "/#/io.l5d.k8s/users", []string{"10.0.1.1:80"}},
+	resolvetest{"/svc=>/$/nope | /#/io.l5d.fs", "/svc/users", "", "/$/nope/users", nil},
+	resolvetest{"/svc=>/#/io.l5d.fs", "/other", "", "~", nil},
+	resolvetest{
+		"/svc=>1*/#/io.l5d.fs & 3*/#/io.l5d.k8s", "/svc/users", "",
+		"/#/io.l5d.fs/users & 3.0 * /#/io.l5d.k8s/users",
+		[]string{"10.0.0.1:80 1", "10.0.1.1:80 3"},
+	},
+}
+
+func TestResolve(t *testing.T) {
+	ctl := NewController()
+	ctl.SetAddr(namer.Path{"#", "io.l5d.fs", "users"}, &namer.Addr{
+		Type:  namer.AddrTypeBound,
+		Addrs: []*namer.Address{{IP: "10.0.0.1", Port: 80}},
+	})
+	ctl.SetAddr(namer.Path{"#", "io.l5d.k8s", "users"}, &namer.Addr{
+		Type:  namer.AddrTypeBound,
+		Addrs: []*namer.Address{{IP: "10.0.1.1", Port: 80}},
+	})
+
+	for _, test := range resolvetests {
+		ctl.Delete("default")
+		if _, err := ctl.Create("default", test.dtab); err != nil {
+			t.Fatalf("%s: unexpected error %s", test.dtab, err)
+		}
+		path, _ := namer.ParsePath(test.path)
+		overlay, _ := namer.ParseDtab(test.overlay)
+
+		tree, err := ctl.Bind(context.Background(), "default", path, overlay)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %s", test.path, err)
+		}
+		if bound := tree.NameTree().String(); bound != test.bound {
+			t.Errorf("%s in %s: expected %s to be bound, got %s", test.path, test.dtab, test.bound, bound)
+		}
+
+		addr, err := ctl.Resolve(context.Background(), "default", path, overlay)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %s", test.path, err)
+		}
+		addrs := []string{}
+		for _, address := range addr.Addrs {
+			s := address.String()
+			if len(test.addrs) > 1 {
+				s += " " + strconv.FormatFloat(address.Weight(), 'g', -1, 64)
+			}
+			addrs = append(addrs, s)
+		}
+		if strings.Join(addrs, ",") != strings.Join(test.addrs, ",") {
+			t.Errorf("%s in %s: expected addresses %q, got %q", test.path, test.dtab, test.addrs, addrs)
+		}
+	}
+}
+
+func TestWatchResolve(t *testing.T) {
+	ctl := NewController()
+	ctl.Create("default", "/svc=>/#/io.l5d.fs")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addrs, err := ctl.WatchResolve(ctx, "default", namer.Path{"svc", "users"}, nil)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if addr := <-addrs; addr.Type != namer.AddrTypeNeg {
+		t.Errorf("expected a neg addr, got %s", addr.Type)
+	}
+	id := namer.Path{"#", "io.l5d.fs", "users"}
+	ctl.SetAddr(id, &namer.Addr{Type: namer.AddrTypeBound, Addrs: []*namer.Address{{IP: "10.0.0.1", Port: 80}}})
+	if addr := <-addrs; addr.Type != namer.AddrTypeBound || len(addr.Addrs) != 1 {
+		t.Errorf("expected one address, got %+v", addr)
+	}
+	ctl.SetAddr(id, nil)
+	if addr := <-addrs; addr.Type != namer.AddrTypeNeg {
+		t.Errorf("expected a neg addr, got %s", addr.Type)
+	}
+
+	cancel()
+	if _, ok := <-addrs; ok {
+		t.Error("expected the watch to end")
+	}
+}
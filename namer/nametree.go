@@ -0,0 +1,238 @@
+package namer
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// DefaultWeight is the weight given to a union branch without an
+// explicit weight.
+const DefaultWeight = 1.0
+
+type (
+	// NameTree is the right-hand side of a dentry: a tree of Paths
+	// combined with alternation and weighted unions. It is one of Leaf,
+	// Alt, Union, Neg, Fail or Empty.
+	NameTree interface {
+		// String renders the tree on one line, exactly as namerd does.
+		String() string
+		// Pretty renders the tree with each alternate and union branch
+		// on its own line. The result parses back to the same tree.
+		Pretty() string
+		// MarshalText encodes the tree as its String form, so that it
+		// appears as a JSON string like in namerd's dtab representation.
+		MarshalText() ([]byte, error)
+		nameTree()
+	}
+
+	// Leaf is a single Path.
+	Leaf struct {
+		Path Path
+	}
+
+	// Alt tries each of its Trees in order, falling back to the next one
+	// when a tree is negative. It is written "a | b".
+	Alt struct {
+		Trees []NameTree
+	}
+
+	// Union load-balances over all of its Trees by weight. It is written
+	// "0.3 * a & 0.7 * b".
+	Union struct {
+		Trees []Weighted
+	}
+
+	// Weighted is a branch of a Union.
+	Weighted struct {
+		Weight float64
+		Tree   NameTree
+	}
+
+	// Neg is the negative tree, "~": it names nothing.
+	Neg struct{}
+
+	// Fail is the failing tree, "!": resolution stops with an error.
+	Fail struct{}
+
+	// Empty is the empty tree, "$": it names an empty set of addresses.
+	Empty struct{}
+)
+
+func (Leaf) nameTree()  {}
+func (Alt) nameTree()   {}
+func (Union) nameTree() {}
+func (Neg) nameTree()   {}
+func (Fail) nameTree()  {}
+func (Empty) nameTree() {}
+
+func (leaf Leaf) Pretty() string   { return prettyTree(leaf, "") }
+func (alt Alt) Pretty() string     { return prettyTree(alt, "") }
+func (union Union) Pretty() string { return prettyTree(union, "") }
+func (Neg) Pretty() string         { return "~" }
+func (Fail) Pretty() string        { return "!" }
+func (Empty) Pretty() string       { return "$" }
+
+func (leaf Leaf) MarshalText() ([]byte, error)   { return marshalTree(leaf) }
+func (alt Alt) MarshalText() ([]byte, error)     { return marshalTree(alt) }
+func (union Union) MarshalText() ([]byte, error) { return marshalTree(union) }
+func (Neg) MarshalText() ([]byte, error)         { return []byte("~"), nil }
+func (Fail) MarshalText() ([]byte, error)        { return []byte("!"), nil }
+func (Empty) MarshalText() ([]byte, error)       { return []byte("$"), nil }
+
+func (leaf Leaf) String() string { return leaf.Path.String() }
+func (Neg) String() string       { return "~" }
+func (Fail) String() string      { return "!" }
+func (Empty) String() string     { return "$" }
+
+func (alt Alt) String() string {
+	if len(alt.Trees) == 1 {
+		return alt.Trees[0].String()
+	}
+	strs := make([]string, len(alt.Trees))
+	for i, tree := range alt.Trees {
+		strs[i] = showUnion(tree)
+	}
+	return strings.Join(strs, " | ")
+}
+
+func (union Union) String() string {
+	if len(union.Trees) == 1 && union.Trees[0].Weight == DefaultWeight {
+		return union.Trees[0].Tree.String()
+	}
+	strs := make([]string, len(union.Trees))
+	for i, w := range union.Trees {
+		strs[i] = w.String()
+	}
+	return strings.Join(strs, " & ")
+}
+
+func (w Weighted) String() string {
+	if w.Weight == DefaultWeight {
+		return showSimple(w.Tree)
+	}
+	return formatWeight(w.Weight) + " * " + showSimple(w.Tree)
+}
+
+// showUnion renders a tree that appears as a branch of an Alt, where a
+// Union binds tighter than "|" and needs no parentheses.
+func showUnion(tree NameTree) string {
+	if union, ok := tree.(Union); ok {
+		return union.String()
+	}
+	return showSimple(tree)
+}
+
+// showSimple renders a tree that appears as an operand, parenthesizing
+// it unless it is a single term.
+func showSimple(tree NameTree) string {
+	switch t := tree.(type) {
+	case Alt:
+		if len(t.Trees) == 1 {
+			return showSimple(t.Trees[0])
+		}
+	case Union:
+		if len(t.Trees) == 1 && t.Trees[0].Weight == DefaultWeight {
+			return showSimple(t.Trees[0].Tree)
+		}
+	default:
+		return tree.String()
+	}
+	return "(" + tree.String() + ")"
+}
+
+// formatWeight renders weights the way Finagle does, always with a
+// fractional part (e.g. "2.0", "0.25").
+func formatWeight(weight float64) string {
+	str := strconv.FormatFloat(weight, 'f', -1, 64)
+	if !strings.Contains(str, ".") {
+		str += ".0"
+	}
+	return str
+}
+
+// prettyTree renders tree with alternates and union branches on separate
+// lines, each continuation line starting with its operator at indent.
+// Unions within alternates and parenthesized subtrees are indented by two
+// more spaces.
+func prettyTree(tree NameTree, indent string) string {
+	switch t := tree.(type) {
+	case Alt:
+		if len(t.Trees) == 1 {
+			return prettyTree(t.Trees[0], indent)
+		}
+		strs := make([]string, len(t.Trees))
+		for i, branch := range t.Trees {
+			if union, ok := branch.(Union); ok {
+				strs[i] = prettyTree(union, indent+"  ")
+			} else {
+				strs[i] = prettySimple(branch, indent)
+			}
+		}
+		return strings.Join(strs, "\n"+indent+"| ")
+
+	case Union:
+		if len(t.Trees) == 1 && t.Trees[0].Weight == DefaultWeight {
+			return prettyTree(t.Trees[0].Tree, indent)
+		}
+		strs := make([]string, len(t.Trees))
+		for i, w := range t.Trees {
+			strs[i] = prettySimple(w.Tree, indent)
+			if w.Weight != DefaultWeight {
+				strs[i] = formatWeight(w.Weight) + " * " + strs[i]
+			}
+		}
+		return strings.Join(strs, "\n"+indent+"& ")
+
+	default:
+		return tree.String()
+	}
+}
+
+// prettySimple is the multi-line counterpart of showSimple.
+func prettySimple(tree NameTree, indent string) string {
+	if showSimple(tree) == tree.String() {
+		return tree.String()
+	}
+	return "(" + prettyTree(tree, indent+"  ") + ")"
+}
+
+func marshalTree(tree NameTree) ([]byte, error) {
+	if err := ValidateNameTree(tree); err != nil {
+		return nil, err
+	}
+	return []byte(tree.String()), nil
+}
+
+// ValidateNameTree checks that every path in tree is valid and that
+// alternates and unions are non-empty with non-negative weights.
+func ValidateNameTree(tree NameTree) error {
+	switch t := tree.(type) {
+	case Leaf:
+		return t.Path.Validate()
+	case Alt:
+		if len(t.Trees) == 0 {
+			return errors.New("alternate has no branches")
+		}
+		for _, branch := range t.Trees {
+			if err := ValidateNameTree(branch); err != nil {
+				return err
+			}
+		}
+	case Union:
+		if len(t.Trees) == 0 {
+			return errors.New("union has no branches")
+		}
+		for _, w := range t.Trees {
+			if w.Weight < 0 {
+				return errors.New("union weights must not be negative")
+			}
+			if err := ValidateNameTree(w.Tree); err != nil {
+				return err
+			}
+		}
+	case nil:
+		return errors.New("missing name tree")
+	}
+	return nil
+}
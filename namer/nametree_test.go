@@ -0,0 +1,94 @@
+package namer
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var roundtrips = []string{
+	"/",
+	"/#/io.l5d.fs/users",
+	`/foo\x20bar/\xff`,
+	"~",
+	"!",
+	"$",
+	"/a | /b | ~",
+	"0.25 * /a & 0.75 * /b",
+	"2.0 * /a",
+	"/a & 2.0 * /b | !",
+	"(/a | /b) & /c",
+	"/a | (/b | /c)",
+	"/a | 0.3 * /b & 0.7 * (/c | $) | ~",
+	"(/a & /b) & (/c | /d)",
+}
+
+func TestNameTreeRoundTrip(t *testing.T) {
+	for _, text := range roundtrips {
+		tree, err := ParseNameTree(text)
+		if err != nil {
+			t.Errorf("%q: unexpected parse error %s", text, err)
+			continue
+		}
+		if show := tree.String(); show != text {
+			t.Errorf("%q: expected string '%s', got '%s'", text, text, show)
+		}
+
+		pretty := tree.Pretty()
+		reparsed, err := ParseNameTree(pretty)
+		if err != nil {
+			t.Errorf("%q: unexpected parse error for pretty form %q: %s", text, pretty, err)
+		} else if !reflect.DeepEqual(reparsed, tree) {
+			t.Errorf("%q: pretty form %q parsed as %s", text, pretty, reparsed)
+		}
+
+		bytes, err := json.Marshal(tree)
+		if err != nil {
+			t.Errorf("%q: unexpected encode error %s", text, err)
+			continue
+		}
+		var str string
+		if err := json.Unmarshal(bytes, &str); err != nil || str != text {
+			t.Errorf("%q: expected json string, got %s", text, bytes)
+		}
+	}
+}
+
+func TestNameTreePretty(t *testing.T) {
+	tree, err := ParseNameTree("/a | 0.3 * /b & 0.7 * (/c | /d) | ~")
+	if err != nil {
+		t.Fatal("unexpected parse error", err)
+	}
+	expected := "/a\n| 0.3 * /b\n  & 0.7 * (/c\n    | /d)\n| ~"
+	if pretty := tree.Pretty(); pretty != expected {
+		t.Errorf("expected pretty:\n%s\ngot:\n%s", expected, pretty)
+	}
+}
+
+func TestPathValidation(t *testing.T) {
+	if _, err := NewPath("svc", ""); err != ErrEmptyLabel {
+		t.Error("expected empty label error, got", err)
+	}
+	if _, err := json.Marshal(Leaf{Path{"a", ""}}); err == nil {
+		t.Error("expected encode error for empty label")
+	}
+
+	path, err := NewPath("svc", "a b")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	bytes, err := json.Marshal(path)
+	if err != nil {
+		t.Fatal("unexpected encode error", err)
+	}
+	if string(bytes) != `"/svc/a\\x20b"` {
+		t.Errorf("unexpected json %s", bytes)
+	}
+	var decoded Path
+	if err := json.Unmarshal(bytes, &decoded); err != nil {
+		t.Fatal("unexpected decode error", err)
+	}
+	if !reflect.DeepEqual(decoded, path) {
+		t.Errorf("expected path %#v, got %#v", path, decoded)
+	}
+}
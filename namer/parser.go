@@ -0,0 +1,489 @@
+package namer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The dtab grammar, as accepted by Finagle:
+//
+//	dtab     ::= dentry ( ';' dentry )* ';'?
+//	dentry   ::= prefix '=>' tree
+//	prefix   ::= '/' ( elem ( '/' elem )* '/'? )?
+//	elem     ::= label | '*'
+//	tree     ::= tree1 ( '|' tree1 )*
+//	tree1    ::= weighted ( '&' weighted )*
+//	weighted ::= ( number '*' )? simple
+//	simple   ::= path | '(' tree ')' | '!' | '~' | '$'
+//	path     ::= '/' ( label ( '/' label )* )?
+//	label    ::= ( [A-Za-z0-9_:.#$%-] | '\x' hex hex )+
+//
+// Whitespace may appear between any two tokens, and '#' starts a comment
+// that runs to the end of the line wherever whitespace is allowed.
+
+// ParseDtab parses a dtab such as "/svc=>/#/io.l5d.fs;/svc/b=>/svc/a".
+// Syntax errors are reported as an ErrorList.
+func ParseDtab(str string) (Dtab, error) {
+	return ParseDtabFile("", str)
+}
+
+// ParseDtabFile parses the dtab in src, which was read from filename.
+// Parsing continues after a malformed dentry at the next ';' so that
+// every syntax error in src is reported in the returned ErrorList.
+func ParseDtabFile(filename, src string) (Dtab, error) {
+	file, err := ParseFile(filename, src)
+	if err != nil {
+		return nil, err
+	}
+	return file.Dtab, nil
+}
+
+// ValidateDtabFile is like ParseDtabFile, but also rejects a prefix that
+// ends with a '/'. ParseDtabFile keeps such a prefix so that Lint can
+// report it, but namerd refuses to store it.
+func ValidateDtabFile(filename, src string) (Dtab, error) {
+	file, err := parseFile(&parser{filename: filename, src: src, strict: true})
+	if err != nil {
+		return nil, err
+	}
+	return file.Dtab, nil
+}
+
+// ParseFile is like ParseDtabFile, but also returns the comments in src.
+func ParseFile(filename, src string) (*File, error) {
+	return parseFile(&parser{filename: filename, src: src})
+}
+
+func parseFile(p *parser) (*File, error) {
+	dtab := Dtab{}
+	var errs ErrorList
+	p.skipSpace()
+	for !p.eof() {
+		if p.maybeEat(';') {
+			p.skipSpace()
+			continue
+		}
+		dentry, err := p.parseDentry()
+		if err == nil {
+			p.skipSpace()
+			if !p.eof() && p.peek() != ';' {
+				err = p.errorf("expected ';'")
+			}
+		}
+		if err != nil {
+			errs = append(errs, err.(*ParseError))
+			p.skipDentry()
+		} else {
+			dtab = append(dtab, dentry)
+		}
+		p.skipSpace()
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return &File{Name: p.filename, Dtab: dtab, Comments: p.comments, src: p.src}, nil
+}
+
+type (
+	// File is a dtab parsed from source text along with its comments,
+	// which are not part of the Dtab.
+	File struct {
+		Name     string
+		Dtab     Dtab
+		Comments []*Comment
+
+		// src is the text the file was parsed from, if any; Format uses
+		// it to preserve blank lines.
+		src string
+	}
+
+	// Comment is a '#' comment, running to the end of its line.
+	Comment struct {
+		Pos Position
+		// Text includes the leading '#'.
+		Text string
+	}
+)
+
+// ParseDentry parses a single dentry such as "/svc => /#/io.l5d.fs".
+func ParseDentry(str string) (*Dentry, error) {
+	p := &parser{src: str}
+	dentry, err := p.parseDentry()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+	return dentry, nil
+}
+
+// ParseNameTree parses the destination side of a dentry, such as
+// "/a | 0.3 * /b & 0.7 * /c".
+func ParseNameTree(str string) (NameTree, error) {
+	p := &parser{src: str}
+	tree, err := p.parseTree()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// ParsePath parses a path such as "/svc/users".
+func ParsePath(str string) (Path, error) {
+	p := &parser{src: str}
+	path, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+	return path, nil
+}
+
+// ParsePrefix parses a dentry prefix such as "/svc/*/users".
+func ParsePrefix(str string) (Prefix, error) {
+	p := &parser{src: str}
+	pfx, err := p.parsePrefix()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+	return pfx, nil
+}
+
+type parser struct {
+	filename string
+	src      string
+	off      int
+	comments []*Comment
+	// strict rejects a trailing slash in a prefix instead of keeping it
+	// as an empty label.
+	strict bool
+}
+
+func (p *parser) eof() bool {
+	return p.off >= len(p.src)
+}
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.off]
+}
+
+func (p *parser) maybeEat(c byte) bool {
+	if p.eof() || p.src[p.off] != c {
+		return false
+	}
+	p.off++
+	return true
+}
+
+// maybeEatAfterSpace is like maybeEat, but allows whitespace before c.
+// Nothing is consumed unless c is found, so that the parser stays just
+// after the last token of a dentry.
+func (p *parser) maybeEatAfterSpace(c byte) bool {
+	save := p.off
+	p.skipSpace()
+	if p.maybeEat(c) {
+		return true
+	}
+	p.off = save
+	return false
+}
+
+func (p *parser) eat(c byte) error {
+	if !p.maybeEat(c) {
+		return p.errorf("expected '%c'", c)
+	}
+	return nil
+}
+
+func (p *parser) expectEOF() error {
+	p.skipSpace()
+	if !p.eof() {
+		return p.errorf("unexpected trailing input")
+	}
+	return nil
+}
+
+// errorf returns a *ParseError at the current offset.
+func (p *parser) errorf(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if p.eof() {
+		msg += ", found end of input"
+	} else {
+		msg += fmt.Sprintf(", found '%c'", p.peek())
+	}
+	return newParseError(p.filename, p.src, p.off, msg)
+}
+
+// skipDentry advances past the rest of a malformed dentry, up to but not
+// including the next ';' outside of a comment.
+func (p *parser) skipDentry() {
+	for !p.eof() && p.peek() != ';' {
+		if p.peek() == '#' {
+			p.skipSpace()
+		} else {
+			p.off++
+		}
+	}
+}
+
+// skipSpace skips whitespace and records the comments it skips.
+func (p *parser) skipSpace() {
+	for !p.eof() {
+		switch p.peek() {
+		case ' ', '\t', '\n', '\r':
+			p.off++
+		case '#':
+			start := p.off
+			for !p.eof() && p.peek() != '\n' {
+				p.off++
+			}
+			// The same comment may be skipped more than once when
+			// maybeEatAfterSpace backtracks.
+			if n := len(p.comments); n == 0 || p.comments[n-1].Pos.Offset < start {
+				p.comments = append(p.comments, &Comment{
+					Pos:  position(p.filename, p.src, start),
+					Text: strings.TrimRight(p.src[start:p.off], " \t\r"),
+				})
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) parseDentry() (*Dentry, error) {
+	p.skipSpace()
+	pos := position(p.filename, p.src, p.off)
+	pfx, err := p.parsePrefix()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.maybeEat('=') || !p.maybeEat('>') {
+		return nil, p.errorf("expected '=>'")
+	}
+	tree, err := p.parseTree()
+	if err != nil {
+		return nil, err
+	}
+	end := position(p.filename, p.src, p.off)
+	return &Dentry{Prefix: pfx, Destination: tree, Pos: pos, End: end}, nil
+}
+
+func (p *parser) parsePrefix() (Prefix, error) {
+	p.skipSpace()
+	if err := p.eat('/'); err != nil {
+		return nil, err
+	}
+	pfx := Prefix{}
+	if !isLabelStart(p.peek()) && p.peek() != '*' {
+		return pfx, nil
+	}
+	for {
+		if p.maybeEat('*') {
+			pfx = append(pfx, PrefixElem{Any: true})
+		} else {
+			label, err := p.parseLabel()
+			if err != nil {
+				return nil, err
+			}
+			pfx = append(pfx, PrefixElem{Label: label})
+		}
+		if !p.maybeEat('/') {
+			return pfx, nil
+		}
+		// A trailing slash is kept as an empty label, which matches no
+		// path, so that it can be reported by Lint.
+		if !isLabelStart(p.peek()) && p.peek() != '*' {
+			if p.strict {
+				return nil, newParseError(p.filename, p.src, p.off-1,
+					"prefix must not end with '/'")
+			}
+			return append(pfx, PrefixElem{}), nil
+		}
+	}
+}
+
+func (p *parser) parsePath() (Path, error) {
+	p.skipSpace()
+	if err := p.eat('/'); err != nil {
+		return nil, err
+	}
+	path := Path{}
+	if !isLabelStart(p.peek()) {
+		return path, nil
+	}
+	for {
+		label, err := p.parseLabel()
+		if err != nil {
+			return nil, err
+		}
+		path = append(path, label)
+		if !p.maybeEat('/') {
+			return path, nil
+		}
+	}
+}
+
+func (p *parser) parseLabel() (string, error) {
+	buf := []byte{}
+	for !p.eof() {
+		c := p.peek()
+		if isLabelChar(c) {
+			buf = append(buf, c)
+			p.off++
+			continue
+		}
+		if c != '\\' {
+			break
+		}
+		p.off++
+		if err := p.eat('x'); err != nil {
+			return "", err
+		}
+		if p.off+2 > len(p.src) {
+			p.off = len(p.src)
+			return "", p.errorf("expected two hex digits")
+		}
+		b, err := strconv.ParseUint(p.src[p.off:p.off+2], 16, 8)
+		if err != nil {
+			return "", p.errorf("expected two hex digits")
+		}
+		buf = append(buf, byte(b))
+		p.off += 2
+	}
+	if len(buf) == 0 {
+		return "", p.errorf("expected a label")
+	}
+	return string(buf), nil
+}
+
+func (p *parser) parseTree() (NameTree, error) {
+	trees := []NameTree{}
+	for {
+		tree, err := p.parseTree1()
+		if err != nil {
+			return nil, err
+		}
+		trees = append(trees, tree)
+		if !p.maybeEatAfterSpace('|') {
+			break
+		}
+	}
+	if len(trees) == 1 {
+		return trees[0], nil
+	}
+	return Alt{Trees: trees}, nil
+}
+
+func (p *parser) parseTree1() (NameTree, error) {
+	trees := []Weighted{}
+	for {
+		w, err := p.parseWeighted()
+		if err != nil {
+			return nil, err
+		}
+		trees = append(trees, w)
+		if !p.maybeEatAfterSpace('&') {
+			break
+		}
+	}
+	if len(trees) == 1 && trees[0].Weight == DefaultWeight {
+		return trees[0].Tree, nil
+	}
+	return Union{Trees: trees}, nil
+}
+
+func (p *parser) parseWeighted() (Weighted, error) {
+	p.skipSpace()
+	weight := DefaultWeight
+	if c := p.peek(); isDigit(c) || c == '.' {
+		start := p.off
+		for isDigit(p.peek()) || p.peek() == '.' {
+			p.off++
+		}
+		w, err := strconv.ParseFloat(p.src[start:p.off], 64)
+		if err != nil {
+			p.off = start
+			return Weighted{}, p.errorf("invalid weight")
+		}
+		weight = w
+		p.skipSpace()
+		if err := p.eat('*'); err != nil {
+			return Weighted{}, err
+		}
+	}
+	tree, err := p.parseSimple()
+	if err != nil {
+		return Weighted{}, err
+	}
+	return Weighted{Weight: weight, Tree: tree}, nil
+}
+
+func (p *parser) parseSimple() (NameTree, error) {
+	p.skipSpace()
+	switch p.peek() {
+	case '(':
+		p.off++
+		tree, err := p.parseTree()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if err := p.eat(')'); err != nil {
+			return nil, err
+		}
+		return tree, nil
+	case '/':
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		return Leaf{Path: path}, nil
+	case '!':
+		p.off++
+		return Fail{}, nil
+	case '~':
+		p.off++
+		return Neg{}, nil
+	case '$':
+		p.off++
+		return Empty{}, nil
+	default:
+		return nil, p.errorf("expected a path, '(', '!', '~' or '$'")
+	}
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// isLabelChar reports whether c may appear unescaped in a label.
+func isLabelChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', isDigit(c):
+		return true
+	}
+	switch c {
+	case '_', ':', '.', '#', '$', '%', '-':
+		return true
+	}
+	return false
+}
+
+func isLabelStart(c byte) bool {
+	return isLabelChar(c) || c == '\\'
+}
@@ -0,0 +1,144 @@
+package namer
+
+import (
+	"reflect"
+	"testing"
+)
+
+type treetest struct {
+	text string
+	ok   bool
+	tree NameTree
+	show string
+}
+
+var testtrees = []treetest{
+	treetest{"/", true, Leaf{Path{}}, "/"},
+	treetest{"/foo/bar", true, leaf("foo", "bar"), "/foo/bar"},
+	treetest{"/$/inet/127.1/4140", true, leaf("$", "inet", "127.1", "4140"), "/$/inet/127.1/4140"},
+	treetest{`/foo\x2Fbar/\x41`, true, leaf("foo/bar", "A"), `/foo\x2fbar/A`},
+	treetest{"~", true, Neg{}, "~"},
+	treetest{"!", true, Fail{}, "!"},
+	treetest{"$", true, Empty{}, "$"},
+	treetest{" /a|/b |/c", true, Alt{[]NameTree{leaf("a"), leaf("b"), leaf("c")}}, "/a | /b | /c"},
+	treetest{
+		"0.3*/a & .7 * /b",
+		true,
+		Union{[]Weighted{{0.3, leaf("a")}, {0.7, leaf("b")}}},
+		"0.3 * /a & 0.7 * /b",
+	},
+	treetest{
+		"/a & 2 * /b | ~",
+		true,
+		Alt{[]NameTree{Union{[]Weighted{{1, leaf("a")}, {2, leaf("b")}}}, Neg{}}},
+		"/a & 2.0 * /b | ~",
+	},
+	treetest{
+		"( /a | /b ) & /c",
+		true,
+		Union{[]Weighted{{1, Alt{[]NameTree{leaf("a"), leaf("b")}}}, {1, leaf("c")}}},
+		"(/a | /b) & /c",
+	},
+	treetest{"((/a))", true, leaf("a"), "/a"},
+	treetest{"/a # a comment\n| /b", true, Alt{[]NameTree{leaf("a"), leaf("b")}}, "/a | /b"},
+	treetest{"", false, nil, ""},
+	treetest{"/a |", false, nil, ""},
+	treetest{"(/a", false, nil, ""},
+	treetest{"/a/", false, nil, ""},
+	treetest{"0.3 /a", false, nil, ""},
+	treetest{"1.2.3 * /a", false, nil, ""},
+	treetest{`/a\x4`, false, nil, ""},
+	treetest{"/a/*", false, nil, ""},
+	treetest{"a", false, nil, ""},
+}
+
+func TestParseNameTree(t *testing.T) {
+	for _, test := range testtrees {
+		tree, err := ParseNameTree(test.text)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("%q: expected parse error got %s", test.text, tree)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected parse error %s", test.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(tree, test.tree) {
+			t.Errorf("%q: expected tree %#v, got %#v", test.text, test.tree, tree)
+		}
+		if show := tree.String(); show != test.show {
+			t.Errorf("%q: expected string '%s', got '%s'", test.text, test.show, show)
+		}
+	}
+}
+
+func TestParsePrefix(t *testing.T) {
+	pfx, err := ParsePrefix("/svc/*/users")
+	if err != nil {
+		t.Fatal("unexpected parse error", err)
+	}
+	expected := Prefix{{Label: "svc"}, {Any: true}, {Label: "users"}}
+	if !reflect.DeepEqual(pfx, expected) {
+		t.Errorf("expected prefix %#v, got %#v", expected, pfx)
+	}
+	if _, err := ParsePath("/svc/*/users"); err == nil {
+		t.Error("expected wildcards to be rejected in paths")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	src := "# routes; with => punctuation\n/svc => /a |;\n/ok => /b;\n/bad  /c;\n\t/x => (/y"
+	_, err := ParseDtabFile("test.dtab", src)
+	errs, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("expected an ErrorList, got %#v", err)
+	}
+	expected := []string{
+		"test.dtab:2:13: expected a path, '(', '!', '~' or '$', found ';'",
+		"test.dtab:4:7: expected '=>', found '/'",
+		"test.dtab:5:11: expected ')', found end of input",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %d: %s", len(expected), len(errs), errs)
+	}
+	for i, e := range errs {
+		if e.Error() != expected[i] {
+			t.Errorf("expected error '%s', got '%s'", expected[i], e)
+		}
+	}
+	if excerpt := errs[1].Excerpt(); excerpt != "/bad  /c;\n      ^" {
+		t.Errorf("unexpected excerpt:\n%s", excerpt)
+	}
+	if excerpt := errs[2].Excerpt(); excerpt != "\t/x => (/y\n\t         ^" {
+		t.Errorf("unexpected excerpt:\n%s", excerpt)
+	}
+}
+
+func TestValidateDtabFileTrailingSlash(t *testing.T) {
+	src := "/svc/ => /a;\n/ok => /b;\n/svc/*/ => /c"
+	if _, err := ParseDtabFile("test.dtab", src); err != nil {
+		t.Fatal("expected ParseDtabFile to keep trailing slashes, got", err)
+	}
+	_, err := ValidateDtabFile("test.dtab", src)
+	errs, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("expected an ErrorList, got %#v", err)
+	}
+	expected := []string{
+		"test.dtab:1:5: prefix must not end with '/'",
+		"test.dtab:3:7: prefix must not end with '/'",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %d: %s", len(expected), len(errs), errs)
+	}
+	for i, e := range errs {
+		if e.Error() != expected[i] {
+			t.Errorf("expected error '%s', got '%s'", expected[i], e)
+		}
+	}
+	if excerpt := errs[0].Excerpt(); excerpt != "/svc/ => /a;\n    ^" {
+		t.Errorf("unexpected excerpt:\n%s", excerpt)
+	}
+}
@@ -0,0 +1,154 @@
+package namer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type (
+	// Path is a hierarchical name such as /svc/users. Each element of
+	// the slice is one label; the empty Path is written "/".
+	Path []string
+
+	// PrefixElem is one element of a dentry Prefix: either a literal
+	// label or the "*" wildcard, which matches any single label.
+	PrefixElem struct {
+		Label string
+		Any   bool
+	}
+
+	// Prefix is the left-hand side of a dentry. It is like a Path, except
+	// that elements may be wildcards.
+	Prefix []PrefixElem
+)
+
+var (
+	// ErrEmptyLabel is returned when validating a Path with an empty label.
+	ErrEmptyLabel = errors.New("path labels must not be empty")
+)
+
+// NewPath builds a Path from labels, which may contain any bytes.
+func NewPath(labels ...string) (Path, error) {
+	path := Path(labels)
+	if err := path.Validate(); err != nil {
+		return nil, err
+	}
+	return path, nil
+}
+
+// Validate checks that every label of the path is non-empty, so that the
+// path can be written and parsed back.
+func (path Path) Validate() error {
+	for _, label := range path {
+		if label == "" {
+			return ErrEmptyLabel
+		}
+	}
+	return nil
+}
+
+func (path Path) String() string {
+	if len(path) == 0 {
+		return "/"
+	}
+	labels := make([]string, len(path))
+	for i, label := range path {
+		labels[i] = escapeLabel(label)
+	}
+	return "/" + strings.Join(labels, "/")
+}
+
+// Concat returns a new Path made of path followed by suffix.
+func (path Path) Concat(suffix Path) Path {
+	out := make(Path, 0, len(path)+len(suffix))
+	out = append(out, path...)
+	return append(out, suffix...)
+}
+
+func (path Path) MarshalText() ([]byte, error) {
+	if err := path.Validate(); err != nil {
+		return nil, err
+	}
+	return []byte(path.String()), nil
+}
+
+func (path *Path) UnmarshalText(text []byte) error {
+	p, err := ParsePath(string(text))
+	if err != nil {
+		return err
+	}
+	*path = p
+	return nil
+}
+
+func (elem PrefixElem) String() string {
+	if elem.Any {
+		return "*"
+	}
+	return escapeLabel(elem.Label)
+}
+
+// Validate checks that every element of the prefix is either a wildcard
+// or a non-empty label. Only the last label may be empty, as it is when
+// the prefix was written with a trailing slash.
+func (pfx Prefix) Validate() error {
+	for i, elem := range pfx {
+		switch {
+		case elem.Any && elem.Label != "":
+			return fmt.Errorf("wildcard prefix element has label '%s'", elem.Label)
+		case !elem.Any && elem.Label == "" && i != len(pfx)-1:
+			return ErrEmptyLabel
+		}
+	}
+	return nil
+}
+
+// TrailingSlash reports whether the prefix was written with a trailing
+// slash, that is, whether its last element is an empty label.
+func (pfx Prefix) TrailingSlash() bool {
+	n := len(pfx)
+	return n > 0 && !pfx[n-1].Any && pfx[n-1].Label == ""
+}
+
+func (pfx Prefix) String() string {
+	if len(pfx) == 0 {
+		return "/"
+	}
+	labels := make([]string, len(pfx))
+	for i, elem := range pfx {
+		labels[i] = elem.String()
+	}
+	return "/" + strings.Join(labels, "/")
+}
+
+func (pfx Prefix) MarshalText() ([]byte, error) {
+	if err := pfx.Validate(); err != nil {
+		return nil, err
+	}
+	return []byte(pfx.String()), nil
+}
+
+func (pfx *Prefix) UnmarshalText(text []byte) error {
+	p, err := ParsePrefix(string(text))
+	if err != nil {
+		return err
+	}
+	*pfx = p
+	return nil
+}
+
+// escapeLabel writes bytes that may not appear literally in a label as
+// \xHH escapes.
+func escapeLabel(label string) string {
+	var buf []byte
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		if isLabelChar(c) {
+			buf = append(buf, c)
+		} else {
+			buf = append(buf, fmt.Sprintf(`\x%02x`, c)...)
+		}
+	}
+	return string(buf)
+}
@@ -0,0 +1,42 @@
+package namer
+
+import (
+	"context"
+	"strconv"
+)
+
+// AddressWeightKey is the metadata key under which Finagle records the
+// weight of an address, for example after a weighted union was resolved.
+const AddressWeightKey = "endpoint_addr_weight"
+
+// Resolve asks namerd to bind path in the namespace ns and to resolve the
+// bound names to the addresses traffic for path would be sent to. Like
+// Bind, overlay's dentries, if any, are added to the namespace's dtab.
+func (ctl *httpController) Resolve(ctx context.Context, ns string, path Path, overlay Dtab) (*Addr, error) {
+	addr := &Addr{}
+	if err := ctl.getJSON(ctx, "resolve/"+ns, pathQuery(path, overlay), addr); err != nil {
+		return nil, err
+	}
+	return addr, nil
+}
+
+// WatchResolve streams the addresses path resolves to in the namespace
+// ns, like Resolve, starting with the current set and then each time it
+// changes.
+func (ctl *httpController) WatchResolve(ctx context.Context, ns string, path Path, overlay Dtab) (<-chan *Addr, error) {
+	return ctl.watchAddr(ctx, "watch of resolve "+path.String(), "resolve/"+ns, pathQuery(path, overlay))
+}
+
+// Weight returns the weight of the address, which is 1 unless its
+// metadata says otherwise.
+func (address *Address) Weight() float64 {
+	switch weight := address.Meta[AddressWeightKey].(type) {
+	case float64:
+		return weight
+	case string:
+		if w, err := strconv.ParseFloat(weight, 64); err == nil {
+			return w
+		}
+	}
+	return DefaultWeight
+}
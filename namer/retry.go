@@ -0,0 +1,170 @@
+package namer
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// RetryPolicy configures how an httpController retries requests that
+// failed transiently, such as while namerd restarts. Only requests that
+// are safe to repeat are retried: List, Get, Delete and Update with a
+// version. Create is never retried.
+//
+// A request that fails after it was sent may still have taken effect. A
+// Delete is then retried anyway, and succeeds if the retry finds the dtab
+// gone. An Update is not, since its retry would fail with
+// ErrVersionConflict; the transport's error is returned instead.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a request is sent, including
+	// the first. Values below 2 disable retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry. Each following
+	// delay is Multiplier times longer, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter randomizes each delay by up to this fraction of it, so that
+	// clients retrying together spread out.
+	Jitter float64
+	// RetryableStatus lists the response statuses that are retried.
+	// Requests that fail without a response, for example because the
+	// connection was refused, are always retried.
+	RetryableStatus []int
+}
+
+// DefaultRetryPolicy retries requests that fail without a response or
+// with a gateway or availability error, for up to about two seconds.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 250 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+	RetryableStatus: []int{
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	},
+}
+
+// WithRetryPolicy makes the controller retry failed requests according
+// to policy. By default, requests are not retried.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(ctl *httpController) {
+		ctl.retry = policy
+	}
+}
+
+// Backoff returns the delay before retry number n, starting at 1.
+func (policy RetryPolicy) Backoff(n int) time.Duration {
+	backoff := float64(policy.InitialBackoff)
+	if policy.Multiplier > 0 {
+		backoff *= math.Pow(policy.Multiplier, float64(n-1))
+	}
+	if policy.MaxBackoff > 0 && backoff > float64(policy.MaxBackoff) {
+		backoff = float64(policy.MaxBackoff)
+	}
+	if policy.Jitter > 0 {
+		backoff += backoff * policy.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(backoff)
+}
+
+func (policy RetryPolicy) retryable(rsp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	for _, status := range policy.RetryableStatus {
+		if rsp.StatusCode == status {
+			return true
+		}
+	}
+	return false
+}
+
+// retryMode says which failed attempts of a request do repeats.
+type retryMode int
+
+const (
+	// noRetry sends the request once.
+	noRetry retryMode = iota
+	// retryAlways repeats every transient failure, for requests that
+	// may safely be applied more than once.
+	retryAlways
+	// retryUnsent only repeats failures that happened before the request
+	// was sent, and retryable statuses, for requests whose retry would
+	// fail if an earlier attempt took effect.
+	retryUnsent
+)
+
+// do sends req, retrying according to the controller's retry policy and
+// mode. It returns ctx's error rather than the transport's when the
+// request was abandoned because ctx is done. It also reports whether an
+// earlier attempt failed after it was sent, and so may have taken effect.
+func (ctl *httpController) do(ctx context.Context, req *http.Request, mode retryMode) (*http.Response, bool, error) {
+	attempts := ctl.retry.MaxAttempts
+	if mode == noRetry || attempts < 1 {
+		attempts = 1
+	}
+	unsure := false
+	for attempt := 1; ; attempt++ {
+		var sent int32
+		req = req.WithContext(httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+			WroteRequest: func(info httptrace.WroteRequestInfo) {
+				if info.Err == nil {
+					atomic.StoreInt32(&sent, 1)
+				}
+			},
+		}))
+		rsp, err := ctl.client.Do(req)
+		if err != nil && ctx.Err() != nil {
+			return nil, unsure, ctx.Err()
+		}
+		if attempt >= attempts || !ctl.retry.retryable(rsp, err) {
+			return rsp, unsure, err
+		}
+		reason := describeFailure(rsp, err)
+		if err != nil && atomic.LoadInt32(&sent) == 1 {
+			if mode == retryUnsent {
+				ctl.logf("%s %s: %s; not retrying, as the request may have taken effect",
+					req.Method, redactURL(req.URL), reason)
+				return rsp, unsure, err
+			}
+			unsure = true
+		}
+		if err == nil {
+			drainAndClose(rsp)
+		}
+		backoff := ctl.retry.Backoff(attempt)
+		ctl.logf("%s %s: %s; retrying in %s (attempt %d of %d)",
+			req.Method, redactURL(req.URL), reason, backoff.Round(time.Millisecond), attempt+1, attempts)
+
+		select {
+		case <-ctx.Done():
+			return nil, unsure, ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, unsure, err
+			}
+		}
+	}
+}
+
+// describeFailure explains why an attempt failed, for log messages.
+func describeFailure(rsp *http.Response, err error) string {
+	if urlErr, ok := err.(*url.Error); ok {
+		return urlErr.Err.Error()
+	} else if err != nil {
+		return err.Error()
+	}
+	return rsp.Status
+}
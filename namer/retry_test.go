@@ -0,0 +1,169 @@
+package namer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts:     3,
+	InitialBackoff:  time.Millisecond,
+	RetryableStatus: []int{http.StatusServiceUnavailable},
+}
+
+type retrytest struct {
+	name     string
+	call     func(Controller) error
+	attempts int
+}
+
+var testretries = []retrytest{
+	retrytest{"list", func(ctl Controller) error { _, err := ctl.List(); return err }, 3},
+	retrytest{"get", func(ctl Controller) error { _, err := ctl.Get("default"); return err }, 3},
+	retrytest{"delete", func(ctl Controller) error { return ctl.Delete("default") }, 3},
+	retrytest{
+		"conditional update",
+		func(ctl Controller) error { _, err := ctl.Update("default", "/a=>/b", Version("1")); return err },
+		3,
+	},
+	retrytest{
+		"unconditional update",
+		func(ctl Controller) error { _, err := ctl.Update("default", "/a=>/b", Version("")); return err },
+		1,
+	},
+	retrytest{"create", func(ctl Controller) error { _, err := ctl.Create("default", "/a=>/b"); return err }, 1},
+}
+
+func TestRetries(t *testing.T) {
+	for _, test := range testretries {
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			if body, _ := ioutil.ReadAll(r.Body); r.Method == "PUT" && string(body) != "/a=>/b" {
+				t.Errorf("%s: attempt %d sent body %q", test.name, attempts, body)
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		u, _ := url.Parse(server.URL)
+		ctl := NewHttpController(u, &http.Client{}, WithRetryPolicy(testRetryPolicy))
+
+		err := test.call(ctl)
+		if apiErr, ok := err.(*APIError); !ok || apiErr.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("%s: expected a 503 APIError, got %#v", test.name, err)
+		}
+		if attempts != test.attempts {
+			t.Errorf("%s: expected %d attempts, got %d", test.name, test.attempts, attempts)
+		}
+		server.Close()
+	}
+}
+
+func TestRetryRecovers(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`["default"]`))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	ctl := NewHttpController(u, &http.Client{}, WithRetryPolicy(testRetryPolicy))
+
+	names, err := ctl.List()
+	if err != nil || len(names) != 1 || names[0] != "default" {
+		t.Errorf("expected [default], got %v, %v", names, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Multiplier: 2}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+	for i, backoff := range expected {
+		if actual := policy.Backoff(i + 1); actual != backoff {
+			t.Errorf("retry %d: expected %s, got %s", i+1, backoff, actual)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if backoff := policy.Backoff(1); backoff < time.Second/2 || backoff > 3*time.Second/2 {
+			t.Fatalf("jittered backoff %s out of range", backoff)
+		}
+	}
+}
+
+// lostResponseServer applies DELETE and conditional PUT requests to the
+// dtab "default" and then closes the connection without responding, as
+// if the response was lost.
+func lostResponseServer(t *testing.T, attempts *int32) *httptest.Server {
+	exists, version := true, 1
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(attempts, 1)
+		switch {
+		case !exists:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case r.Method == "DELETE":
+			exists = false
+		case r.Method == "PUT" && r.Header.Get("If-Match") == strconv.Itoa(version):
+			version++
+		case r.Method == "PUT":
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+	}))
+}
+
+func TestRetryLostDelete(t *testing.T) {
+	var attempts int32
+	server := lostResponseServer(t, &attempts)
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	ctl := NewHttpController(u, &http.Client{}, WithRetryPolicy(testRetryPolicy))
+
+	if err := ctl.Delete("default"); err != nil {
+		t.Errorf("expected the retried delete to succeed, got %v", err)
+	}
+	if attempts := atomic.LoadInt32(&attempts); attempts != 2 {
+		t.Errorf("expected 2 attempts, got %d", attempts)
+	}
+
+	// Without a lost response, a 404 is still reported.
+	atomic.StoreInt32(&attempts, 0)
+	if err := ctl.Delete("default"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if attempts := atomic.LoadInt32(&attempts); attempts != 1 {
+		t.Errorf("expected 1 attempt, got %d", attempts)
+	}
+}
+
+func TestRetryLostUpdate(t *testing.T) {
+	var attempts int32
+	server := lostResponseServer(t, &attempts)
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	ctl := NewHttpController(u, &http.Client{}, WithRetryPolicy(testRetryPolicy))
+
+	_, err := ctl.Update("default", "/a=>/b", Version("1"))
+	if _, ok := err.(*url.Error); !ok {
+		t.Errorf("expected the transport's error, got %#v", err)
+	}
+	if attempts := atomic.LoadInt32(&attempts); attempts != 1 {
+		t.Errorf("expected 1 attempt, got %d", attempts)
+	}
+}
@@ -0,0 +1,211 @@
+package namer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// sensitiveHeaders are never logged in full.
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// tracedHeaders are logged for every request and response, even when
+// the other headers are not.
+var tracedHeaders = []string{"If-Match", "ETag"}
+
+type (
+	// tracer logs the requests a controller sends and the responses it
+	// receives.
+	tracer struct {
+		logger Logger
+		bodies bool
+	}
+
+	// tracingTransport is the transport of a traced controller.
+	tracingTransport struct {
+		// requests numbers the requests, so that the lines of concurrent
+		// ones can be told apart. It is first for 64-bit alignment.
+		requests uint64
+		*tracer
+		next http.RoundTripper
+		// redacted holds the canonical names of the headers whose values
+		// are not logged.
+		redacted map[string]bool
+	}
+
+	// tracedBody logs a response body as it is read, so that watches are
+	// logged as their values arrive.
+	tracedBody struct {
+		io.ReadCloser
+		transport *tracingTransport
+		id        uint64
+		// pending is read but not logged yet.
+		pending []byte
+		// depth, inString and escaped follow the JSON structure of the
+		// body, so that a value can be logged as soon as it ends.
+		depth    int
+		inString bool
+		escaped  bool
+	}
+)
+
+// WithTrace makes the controller log each request and response to
+// logger: the method and URL, the status and latency, and the ETag and
+// If-Match headers. With bodies, every header and the bodies are logged
+// too. Credentials, cookies and the headers given to WithHeader are
+// redacted.
+func WithTrace(logger Logger, bodies bool) Option {
+	return func(ctl *httpController) {
+		ctl.trace = &tracer{logger: logger, bodies: bodies}
+	}
+}
+
+// traceClient returns a copy of client whose requests are traced. The
+// headers in header are redacted.
+func (t *tracer) traceClient(client *http.Client, header http.Header) *http.Client {
+	transport := &tracingTransport{tracer: t, next: client.Transport, redacted: map[string]bool{}}
+	if transport.next == nil {
+		transport.next = http.DefaultTransport
+	}
+	for _, key := range sensitiveHeaders {
+		transport.redacted[http.CanonicalHeaderKey(key)] = true
+	}
+	for key := range header {
+		transport.redacted[http.CanonicalHeaderKey(key)] = true
+	}
+
+	traced := *client
+	traced.Transport = transport
+	return &traced
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := atomic.AddUint64(&t.requests, 1)
+	t.logf(id, "> %s %s", req.Method, redactURL(req.URL))
+	t.logHeaders(id, ">", req.Header)
+
+	if t.bodies && req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		t.logBody(id, ">", body)
+		// A RoundTripper must not modify the request it is given.
+		copied := *req
+		copied.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req = &copied
+	}
+
+	start := time.Now()
+	rsp, err := t.next.RoundTrip(req)
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		t.logf(id, "! %s (%s)", err, elapsed)
+		return nil, err
+	}
+	t.logf(id, "< %s (%s)", rsp.Status, elapsed)
+	t.logHeaders(id, "<", rsp.Header)
+	if t.bodies {
+		rsp.Body = &tracedBody{ReadCloser: rsp.Body, transport: t, id: id}
+	}
+	return rsp, nil
+}
+
+func (t *tracingTransport) logf(id uint64, format string, args ...interface{}) {
+	t.logger.Printf("[%d] "+format, append([]interface{}{id}, args...)...)
+}
+
+// logHeaders logs the traced headers, or every header when bodies are
+// logged, in order.
+func (t *tracingTransport) logHeaders(id uint64, dir string, header http.Header) {
+	keys := tracedHeaders
+	if t.bodies {
+		keys = make([]string, 0, len(header))
+		for key := range header {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+	}
+	for _, key := range keys {
+		key = http.CanonicalHeaderKey(key)
+		for _, value := range header[key] {
+			if t.redacted[key] {
+				value = "REDACTED"
+			}
+			t.logf(id, "%s %s: %s", dir, key, value)
+		}
+	}
+}
+
+func (t *tracingTransport) logBody(id uint64, dir string, body []byte) {
+	for _, line := range strings.Split(strings.TrimRight(string(body), "\n"), "\n") {
+		if line != "" {
+			t.logf(id, "%s %s", dir, line)
+		}
+	}
+}
+
+// Read logs the body a line at a time, or a JSON value at a time for
+// watches that do not end their values with newlines.
+func (body *tracedBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	start := 0
+	for i, c := range p[:n] {
+		if c == '\n' {
+			body.pending = append(body.pending, p[start:i]...)
+			body.flush()
+			start = i + 1
+			// JSON strings cannot hold newlines, so this ends any string
+			// in text that is not JSON.
+			body.inString, body.escaped = false, false
+		} else if body.endsValue(c) {
+			body.pending = append(body.pending, p[start:i+1]...)
+			body.flush()
+			start = i + 1
+		}
+	}
+	body.pending = append(body.pending, p[start:n]...)
+	if err != nil {
+		body.flush()
+	}
+	return n, err
+}
+
+// endsValue follows the JSON structure of the body through c, and
+// reports whether c ends a top-level object or array.
+func (body *tracedBody) endsValue(c byte) bool {
+	switch {
+	case body.escaped:
+		body.escaped = false
+	case body.inString:
+		if c == '\\' {
+			body.escaped = true
+		} else if c == '"' {
+			body.inString = false
+		}
+	case c == '"':
+		body.inString = true
+	case c == '{' || c == '[':
+		body.depth++
+	case (c == '}' || c == ']') && body.depth > 0:
+		body.depth--
+		return body.depth == 0
+	}
+	return false
+}
+
+func (body *tracedBody) Close() error {
+	body.flush()
+	return body.ReadCloser.Close()
+}
+
+func (body *tracedBody) flush() {
+	body.transport.logBody(body.id, "<", body.pending)
+	body.pending = nil
+}
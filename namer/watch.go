@@ -0,0 +1,305 @@
+package namer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// Watch streams the named dtab from namerd, starting with its current
+// version and then each time it changes, until ctx is done. The stream
+// is reopened when it is interrupted, waiting between attempts as the
+// controller's retry policy does. If namerd then rejects the watch, for
+// example because the dtab was deleted, the channel is closed early and
+// the reason is logged.
+func (ctl *httpController) Watch(ctx context.Context, name string) (<-chan *VersionedDtab, error) {
+	open := func() (*http.Response, error) {
+		return ctl.watchRequest(ctx, dtabEndpoint(name), nil)
+	}
+	rsp, err := open()
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(chan *VersionedDtab)
+	go func() {
+		defer close(updates)
+		var last *VersionedDtab
+		ctl.stream(ctx, "watch of "+name, rsp, open, func(raw json.RawMessage) error {
+			vd := &VersionedDtab{}
+			if len(raw) > 0 && raw[0] == '{' {
+				if err := json.Unmarshal(raw, vd); err != nil {
+					return err
+				}
+			} else if err := json.Unmarshal(raw, &vd.Dtab); err != nil {
+				return err
+			}
+			// namerd sends the current version again when the stream is
+			// reopened.
+			if last != nil && vd.Version == last.Version && vd.Dtab.String() == last.Dtab.String() {
+				return nil
+			}
+			last = vd
+			select {
+			case updates <- vd:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+	return updates, nil
+}
+
+type (
+	// EventType is the kind of change a NamespaceEvent reports.
+	EventType string
+
+	// NamespaceEvent reports that a dtab was created or deleted.
+	NamespaceEvent struct {
+		Type EventType `json:"type"`
+		Name string    `json:"name"`
+	}
+)
+
+const (
+	Added   EventType = "ADDED"
+	Removed EventType = "REMOVED"
+)
+
+// WatchList streams the names of namerd's dtabs as events: first an
+// ADDED event for each dtab that exists, then one for each dtab created
+// or deleted afterwards, until ctx is done. Like Watch, the stream is
+// reopened when it is interrupted; changes made in the meantime are
+// reported once it is.
+func (ctl *httpController) WatchList(ctx context.Context) (<-chan *NamespaceEvent, error) {
+	open := func() (*http.Response, error) {
+		return ctl.watchRequest(ctx, dtabEndpoint(""), nil)
+	}
+	rsp, err := open()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan *NamespaceEvent)
+	go func() {
+		defer close(events)
+		known := map[string]bool{}
+		ctl.stream(ctx, "watch of dtab names", rsp, open, func(raw json.RawMessage) error {
+			var names []string
+			if err := json.Unmarshal(raw, &names); err != nil {
+				return err
+			}
+			for _, event := range NamespaceEvents(known, names) {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			return nil
+		})
+	}()
+	return events, nil
+}
+
+// NamespaceEvents returns the events that turn the set of known names
+// into names, updating known to match. Removals come first; each group
+// is sorted by name. Controllers use it to implement WatchList.
+func NamespaceEvents(known map[string]bool, names []string) []*NamespaceEvent {
+	current := map[string]bool{}
+	for _, name := range names {
+		current[name] = true
+	}
+
+	var removed, added []string
+	for name := range known {
+		if !current[name] {
+			removed = append(removed, name)
+			delete(known, name)
+		}
+	}
+	for name := range current {
+		if !known[name] {
+			added = append(added, name)
+			known[name] = true
+		}
+	}
+	sort.Strings(removed)
+	sort.Strings(added)
+
+	events := make([]*NamespaceEvent, 0, len(removed)+len(added))
+	for _, name := range removed {
+		events = append(events, &NamespaceEvent{Removed, name})
+	}
+	for _, name := range added {
+		events = append(events, &NamespaceEvent{Added, name})
+	}
+	return events
+}
+
+// watchJSON opens a watch of endpoint and passes each of its JSON values
+// that differs from the previous one to emit, in a new goroutine that
+// calls done once the watch ends. what describes the watch in log
+// messages.
+func (ctl *httpController) watchJSON(ctx context.Context, what, endpoint string, query url.Values, emit func(json.RawMessage) error, done func()) error {
+	open := func() (*http.Response, error) {
+		return ctl.watchRequest(ctx, endpoint, query)
+	}
+	rsp, err := open()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer done()
+		var last []byte
+		ctl.stream(ctx, what, rsp, open, func(raw json.RawMessage) error {
+			// namerd sends the current value again when the stream is
+			// reopened.
+			if bytes.Equal(raw, last) {
+				return nil
+			}
+			last = raw
+			return emit(raw)
+		})
+	}()
+	return nil
+}
+
+// watchRequest opens a watch of endpoint, which namerd streams as a
+// sequence of JSON values.
+func (ctl *httpController) watchRequest(ctx context.Context, endpoint string, query url.Values) (*http.Response, error) {
+	// The client's timeout would end the stream, so it is replaced by one
+	// that only applies until the response headers are received.
+	watchCtx, cancel := context.WithCancel(ctx)
+	client := *ctl.client
+	client.Timeout = 0
+	if ctl.client.Timeout > 0 {
+		timer := time.AfterFunc(ctl.client.Timeout, cancel)
+		defer timer.Stop()
+	}
+
+	watchQuery := url.Values{"watch": {"true"}}
+	for key, values := range query {
+		watchQuery[key] = values
+	}
+	req, err := ctl.apiRequest(watchCtx, "GET", endpoint, watchQuery, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	rsp, err := client.Do(req)
+	if err != nil {
+		cancel()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		defer cancel()
+		defer drainAndClose(rsp)
+		return nil, responseError(rsp)
+	}
+	rsp.Body = &cancelOnClose{rsp.Body, cancel}
+	return rsp, nil
+}
+
+// cancelOnClose releases the context of a watch when its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (body *cancelOnClose) Close() error {
+	err := body.ReadCloser.Close()
+	body.cancel()
+	return err
+}
+
+// stream passes each JSON value of a watch response to emit, reopening
+// the watch with open whenever the response ends, until ctx is done, emit
+// returns an error or namerd rejects the watch. what describes the watch
+// in log messages.
+func (ctl *httpController) stream(ctx context.Context, what string, rsp *http.Response, open func() (*http.Response, error), emit func(json.RawMessage) error) {
+	failures := 0
+	for {
+		if rsp != nil {
+			dec := json.NewDecoder(rsp.Body)
+			var emitErr error
+			for emitErr == nil {
+				var raw json.RawMessage
+				if err := dec.Decode(&raw); err != nil {
+					break
+				}
+				failures = 0
+				emitErr = emit(raw)
+			}
+			drainAndClose(rsp)
+			if ctx.Err() != nil {
+				return
+			}
+			if emitErr != nil {
+				ctl.logf("%s ended: %s", what, emitErr)
+				return
+			}
+		}
+
+		failures++
+		backoff := ctl.watchBackoff(failures)
+		ctl.logf("%s interrupted; reopening in %s", what, backoff.Round(time.Millisecond))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		var err error
+		if rsp, err = open(); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if !ctl.watchRetryable(err) {
+				ctl.logf("%s ended: %s", what, err)
+				return
+			}
+			ctl.logf("%s: %s", what, err)
+		}
+	}
+}
+
+// watchBackoff returns the delay before reopening a watch that failed n
+// times in a row. Watches are always reopened, even when the retry
+// policy does not retry requests.
+func (ctl *httpController) watchBackoff(n int) time.Duration {
+	policy := ctl.retry
+	if policy.InitialBackoff <= 0 {
+		policy = DefaultRetryPolicy
+	}
+	return policy.Backoff(n)
+}
+
+// watchRetryable reports whether a watch that could not be reopened
+// because of err should be tried again.
+func (ctl *httpController) watchRetryable(err error) bool {
+	switch e := err.(type) {
+	case *url.Error:
+		return true
+	case *APIError:
+		policy := ctl.retry
+		if policy.RetryableStatus == nil {
+			policy = DefaultRetryPolicy
+		}
+		return policy.retryable(&http.Response{StatusCode: e.StatusCode}, nil)
+	default:
+		return false
+	}
+}
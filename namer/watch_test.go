@@ -0,0 +1,153 @@
+package namer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	// Each connection gets the next batch of values, then is closed.
+	batches := []string{
+		`[{"prefix":"/a","dst":"/b"}]` + "\n" + `[{"prefix":"/a","dst":"/c"}]`,
+		`[{"prefix":"/a","dst":"/c"}]{"version":"3","dtab":[{"prefix":"/a","dst":"/d"}]}`,
+	}
+	connections := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("watch") != "true" {
+			t.Errorf("expected a watch request, got %s", r.URL)
+		}
+		if connections == len(batches) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(batches[connections]))
+		connections++
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	ctl := NewHttpController(u, &http.Client{Timeout: time.Second},
+		WithRetryPolicy(RetryPolicy{InitialBackoff: time.Millisecond})).(Watcher)
+
+	updates, err := ctl.Watch(context.Background(), "default")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	got := []string{}
+	for vd := range updates {
+		got = append(got, string(vd.Version)+" "+vd.Dtab.String())
+	}
+	expected := []string{" /a=>/b;", " /a=>/c;", "3 /a=>/d;"}
+	if len(got) != len(expected) {
+		t.Fatalf("expected updates %q, got %q", expected, got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("expected update %q, got %q", expected[i], got[i])
+		}
+	}
+}
+
+func TestWatchCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"prefix":"/a","dst":"/b"}]`))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	ctl := NewHttpController(u, &http.Client{}).(Watcher)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates, err := ctl.Watch(ctx, "default")
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if vd := <-updates; vd == nil || vd.Dtab.String() != "/a=>/b;" {
+		t.Fatalf("unexpected first update %v", vd)
+	}
+	cancel()
+	select {
+	case _, ok := <-updates:
+		if ok {
+			t.Error("expected the channel to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Error("watch was not cancelled")
+	}
+}
+
+func TestWatchNotFound(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	ctl := NewHttpController(u, &http.Client{}).(Watcher)
+	if _, err := ctl.Watch(context.Background(), "default"); err != ErrNotFound {
+		t.Errorf("expected %v, got %v", ErrNotFound, err)
+	}
+}
+
+func TestWatchList(t *testing.T) {
+	batches := []string{
+		`["a","b"]` + "\n" + `["a","b","c"]`,
+		`["b","c","d"]`,
+	}
+	connections := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/1/dtabs" || r.URL.Query().Get("watch") != "true" {
+			t.Errorf("expected a watch of the dtab list, got %s", r.URL)
+		}
+		if connections == len(batches) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(batches[connections]))
+		connections++
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	ctl := NewHttpController(u, &http.Client{Timeout: time.Second},
+		WithRetryPolicy(RetryPolicy{InitialBackoff: time.Millisecond})).(ListWatcher)
+
+	events, err := ctl.WatchList(context.Background())
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	got := []string{}
+	for event := range events {
+		got = append(got, string(event.Type)+" "+event.Name)
+	}
+	expected := []string{"ADDED a", "ADDED b", "ADDED c", "REMOVED a", "ADDED d"}
+	if len(got) != len(expected) {
+		t.Fatalf("expected events %q, got %q", expected, got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("expected event %q, got %q", expected[i], got[i])
+		}
+	}
+}
+
+func TestNamespaceEvents(t *testing.T) {
+	known := map[string]bool{"b": true, "z": true, "a": true}
+	events := NamespaceEvents(known, []string{"d", "b", "c"})
+	got := []string{}
+	for _, event := range events {
+		got = append(got, string(event.Type)+" "+event.Name)
+	}
+	expected := []string{"REMOVED a", "REMOVED z", "ADDED c", "ADDED d"}
+	if len(got) != len(expected) {
+		t.Fatalf("expected events %q, got %q", expected, got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("expected event %q, got %q", expected[i], got[i])
+		}
+	}
+	if len(known) != 3 || !known["b"] || !known["c"] || !known["d"] {
+		t.Errorf("expected known to be updated to b, c and d, got %v", known)
+	}
+}